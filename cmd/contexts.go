@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
+)
+
+// reachableTimeout bounds the probe of every context before it's registered
+const reachableTimeout = 10 * time.Second
+
+// runContexts registers every context of kubeconfig matching filter as a spoke-cluster with a shared bootstrap token,
+// the invalid and unreachable contexts are skipped and reported
+func runContexts(ctx context.Context, hubCluster *hub.Cluster, template register.Options, kubeconfig, filter string, workers int, timeout time.Duration) int {
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		klog.InfoS("Invalid filter of contexts", "filter", filter, "err", err)
+		return 1
+	}
+	contexts, err := hub.SplitKubeConfigContexts(kubeconfig, re)
+	if err != nil {
+		klog.InfoS("Fail to load the contexts of kubeconfig", "err", err)
+		return 1
+	}
+	if len(contexts) == 0 {
+		klog.InfoS("No context of kubeconfig matches the filter", "filter", filter)
+		return 1
+	}
+
+	report := inventoryReport{}
+	var items []register.Options
+	for _, c := range contexts {
+		if c.Err != nil {
+			klog.InfoS("Skip invalid context", "context", c.Context, "name", c.ClusterName, "err", c.Err)
+			report.skip(c, c.Err)
+			continue
+		}
+		if err = checkReachable(c.Config); err != nil {
+			klog.InfoS("Skip unreachable context", "context", c.Context, "name", c.ClusterName, "err", err)
+			report.skip(c, err)
+			continue
+		}
+		klog.InfoS("register context", "context", c.Context, "name", c.ClusterName)
+		opts := template
+		opts.ClusterName = c.ClusterName
+		opts.SpokeConfig = c.Config
+		items = append(items, opts)
+	}
+	if len(items) != 0 {
+		// the bootstrap RBAC is applied and the token is minted only once
+		hubKubeConfig, err := hubCluster.GenerateHubClusterKubeConfig(ctx, template.HubAPIServer)
+		if err != nil {
+			klog.InfoS("Fail to generate the token for spoke-clusters", "err", err)
+			return 1
+		}
+		for i := range items {
+			items[i].HubKubeConfig = hubKubeConfig
+		}
+		report.add(register.RunBatch(ctx, hubCluster, items, workers, timeout))
+	}
+	return report.print()
+}
+
+// checkReachable probes the apiserver of spoke-cluster
+func checkReachable(config *rest.Config) error {
+	config = rest.CopyConfig(config)
+	config.Timeout = reachableTimeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	_, err = discoveryClient.ServerVersion()
+	return err
+}
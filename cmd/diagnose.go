@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/diagnose"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+)
+
+// runDiagnose collects the state of the registration of a cluster from both sides into a support bundle,
+// and explains the common failures. Only the hub-cluster is diagnosed if no credential of spoke-cluster is given.
+func runDiagnose(args []string) int {
+	var opts options
+	var credentialSecret string
+	var output string
+	var logLines int64
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	opts.addFlags(fs)
+	fs.StringVar(&credentialSecret, "credential-secret", "", "<namespace>/<name> of a secret on hub cluster with the credential of the spoke cluster, instead of the credential flags")
+	fs.StringVar(&output, "output", "", "path of the support bundle, <cluster>-diagnose-<time>.tar.gz if empty")
+	fs.Int64Var(&logLines, "log-lines", 1000, "number of the last lines of each container log")
+	_ = fs.Parse(args)
+	opts.decodeParameters()
+	if len(opts.clusterName) == 0 {
+		klog.InfoS("The cluster name is required")
+		return 1
+	}
+	if len(output) == 0 {
+		output = fmt.Sprintf("%s-diagnose-%s.tar.gz", opts.clusterName, time.Now().Format("20060102150405"))
+	}
+
+	ctx := context.Background()
+	hubCluster, err := hub.NewHubCluster(nil)
+	if err != nil {
+		klog.InfoS("Fail to create client connect to hub cluster", "err", err)
+		return 1
+	}
+	collector := &diagnose.Collector{
+		ClusterName:  opts.clusterName,
+		Hub:          hubCluster,
+		HubAPIServer: opts.hubIP,
+		LogLines:     logLines,
+	}
+	spokeConfig, err := diagnoseSpokeConfig(ctx, hubCluster, &opts, credentialSecret)
+	if err != nil {
+		klog.InfoS("Fail to get spoke-cluster kubeconfig, only hub cluster is diagnosed", "err", err)
+	}
+	if spokeConfig != nil {
+		if collector.Spoke, err = spoke.NewSpokeCluster(opts.clusterName, spokeConfig, nil); err != nil {
+			klog.InfoS("Fail to create client connect to spoke cluster, only hub cluster is diagnosed", "err", err)
+		}
+	}
+
+	bundle := collector.Collect(ctx)
+	f, err := os.Create(output)
+	if err != nil {
+		klog.InfoS("Fail to create the support bundle", "path", output, "err", err)
+		return 1
+	}
+	if err = bundle.WriteTarball(f); err != nil {
+		_ = f.Close()
+		klog.InfoS("Fail to write the support bundle", "path", output, "err", err)
+		return 1
+	}
+	if err = f.Close(); err != nil {
+		klog.InfoS("Fail to write the support bundle", "path", output, "err", err)
+		return 1
+	}
+	fmt.Print(bundle.Summary())
+	fmt.Printf("\nSupport bundle is written to %s\n", output)
+	return 0
+}
+
+// diagnoseSpokeConfig builds the rest config of spoke-cluster from the credential secret or flags, nil if none is given
+func diagnoseSpokeConfig(ctx context.Context, hubCluster *hub.Cluster, opts *options, credentialSecret string) (*rest.Config, error) {
+	if len(credentialSecret) != 0 {
+		namespace, name, err := splitNamespacedName(credentialSecret)
+		if err != nil {
+			return nil, err
+		}
+		secret := new(corev1.Secret)
+		if err = hubCluster.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+			return nil, err
+		}
+		return spokeConfigFromSecret(secret)
+	}
+	if len(opts.spokeInfo.KubeConfig) == 0 && len(opts.spokeInfo.APIServer) == 0 {
+		return nil, nil
+	}
+	return opts.spokeConfig()
+}
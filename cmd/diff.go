@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+)
+
+// printDiff prints the unified diff between the live objects and the rendered objects of both clusters
+func printDiff(ctx context.Context, hubCluster *hub.Cluster, spokeCluster *spoke.Cluster) error {
+	hubObjects, err := hubCluster.RenderBootstrapResources()
+	if err != nil {
+		return err
+	}
+	spokeObjects, err := spokeCluster.RenderSpokeClusterEnv()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range []struct {
+		cluster string
+		client  client.Client
+		objects []*unstructured.Unstructured
+	}{
+		{cluster: "hub", client: hubCluster.Client, objects: hubObjects},
+		{cluster: "spoke", client: spokeCluster.Args.Client, objects: spokeObjects},
+	} {
+		for _, obj := range item.objects {
+			diff, err := common.DiffObject(ctx, item.client, obj)
+			if err != nil {
+				return fmt.Errorf("fail to diff %s %s on %s cluster: %w", obj.GetKind(), obj.GetName(), item.cluster, err)
+			}
+			if len(diff) == 0 {
+				continue
+			}
+			if _, err = fmt.Fprintf(os.Stdout, "# %s cluster\n%s", item.cluster, diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "strings"
+
+// stringSlice is a flag.Value collecting the values of a repeatable flag in order
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
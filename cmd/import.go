@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// runImportFromVela registers the cluster-gateway clusters of KubeVela to OCM with the credentials in their secrets.
+// The cluster name and credential flags are ignored, they are taken from each secret.
+func runImportFromVela(args []string) int {
+	var opts options
+	var clusters string
+	var switchToOCM bool
+	var dryRun string
+	var rollbackOnFailure bool
+	var traceOpts tracing.Options
+	var insecureSkipTLSVerify bool
+	fs := flag.NewFlagSet("import-from-vela", flag.ExitOnError)
+	opts.addFlags(fs)
+	addTracingFlags(fs, &traceOpts)
+	fs.StringVar(&clusters, "clusters", "", "names of the cluster secrets to import, in the form of c1,c2, all of them if empty")
+	fs.BoolVar(&switchToOCM, "switch-to-ocm", false, "enable the cluster-proxy add-on, and switch the imported cluster secrets to reach the clusters through it once available")
+	fs.StringVar(&dryRun, "dry-run", "", "must be \"server\" or empty, if server, every create, update and approval is sent as a server-side dry-run")
+	fs.BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "delete the objects created and restore the objects updated for a cluster if its import fails")
+	fs.BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "import the cluster secrets without ca.crt, without verifying the server certificate of the clusters")
+	_ = fs.Parse(args)
+	opts.decodeParameters()
+
+	if dryRun != "" && dryRun != "server" {
+		klog.InfoS("Unsupported dry-run mode", "mode", dryRun)
+		return 1
+	}
+	accept, err := opts.acceptOptions()
+	if err != nil {
+		klog.InfoS("Invalid metadata of managed cluster", "err", err)
+		return 1
+	}
+	clusterSetBindings, err := opts.clusterSetBindings()
+	if err != nil {
+		klog.InfoS("Invalid cluster set of managed cluster", "err", err)
+		return 1
+	}
+	claims, err := opts.parseClaims()
+	if err != nil {
+		klog.InfoS("Invalid claims of managed cluster", "err", err)
+		return 1
+	}
+	addons, err := opts.parseAddons()
+	if err != nil {
+		klog.InfoS("Invalid addons of managed cluster", "err", err)
+		return 1
+	}
+
+	var clusterNames []string
+	for _, name := range strings.Split(clusters, ",") {
+		if name = strings.TrimSpace(name); len(name) != 0 {
+			clusterNames = append(clusterNames, name)
+		}
+	}
+
+	ctx := context.Background()
+
+	flushSpans, err := setupTracing(ctx, traceOpts)
+	if err != nil {
+		klog.InfoS("Fail to set up tracing", "err", err)
+		return 1
+	}
+	defer flushSpans()
+
+	hubCluster, err := hub.NewHubCluster(nil)
+	if err != nil {
+		klog.InfoS("Fail to create client connect to hub cluster", "err", err)
+		return 1
+	}
+	overrides, err := loadOverrides(ctx, hubCluster, opts.resourceDir, opts.resourceConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load resource overrides", "err", err)
+		return 1
+	}
+	hubCluster.Overrides = overrides
+	baseline, err := loadBaseline(ctx, hubCluster, opts.baselineDir, opts.baselineConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load baseline manifests", "err", err)
+		return 1
+	}
+	if dryRun == "server" {
+		hubCluster.EnableDryRun()
+	}
+
+	results, err := register.ImportFromVela(ctx, hubCluster, register.ImportOptions{
+		Options: register.Options{
+			HubAPIServer:       opts.hubIP,
+			Overrides:          overrides,
+			DryRun:             dryRun == "server",
+			RollbackOnFailure:  rollbackOnFailure,
+			Accept:             accept,
+			ClusterSet:         opts.clusterSet,
+			ClusterSetBindings: clusterSetBindings,
+			Claims:             claims,
+			Addons:             addons,
+			Baseline:           baseline,
+			WaitBaseline:       opts.waitBaseline,
+		},
+		Clusters:              clusterNames,
+		SwitchToOCM:           switchToOCM,
+		InsecureSkipTLSVerify: insecureSkipTLSVerify,
+	})
+	if err != nil {
+		klog.InfoS("Fail to import clusters of KubeVela", "err", err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			klog.InfoS("Fail to import cluster", "name", result.Cluster, "err", result.Err)
+		case len(result.Skipped) != 0:
+			klog.InfoS("skip cluster", "name", result.Cluster, "reason", result.Skipped)
+		default:
+			klog.InfoS("successfully import cluster", "name", result.Cluster, "dryRun", dryRun == "server")
+		}
+	}
+	if failed != 0 {
+		klog.InfoS("Fail to import some clusters", "failed", failed, "total", len(results))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+)
+
+// inventory lists the spoke-clusters registered by one run
+type inventory struct {
+	Clusters []inventoryCluster `json:"clusters"`
+}
+
+// inventoryCluster is a spoke-cluster of the inventory, the metadata are in the same format as the flags,
+// and are merged with the ones given by flags
+type inventoryCluster struct {
+	Name string `json:"name"`
+	// CredentialSecret is <namespace>/<name> of a secret on hub cluster, in the same format as the cluster secret
+	// of the ComponentDefinition, i.e. with kubeconfig or api_server_internet, cluster_ca_cert, client_cert and client_key
+	CredentialSecret  string            `json:"credentialSecret"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	Taints            string            `json:"taints,omitempty"`
+	ClusterSet        string            `json:"clusterSet,omitempty"`
+	ClusterSetBinding string            `json:"clusterSetBinding,omitempty"`
+	Claims            map[string]string `json:"claims,omitempty"`
+	Addons            string            `json:"addons,omitempty"`
+}
+
+// inventoryReport is the aggregated outcome of an inventory run
+type inventoryReport struct {
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Skipped   int                    `json:"skipped,omitempty"`
+	Clusters  []inventoryReportEntry `json:"clusters"`
+}
+
+type inventoryReportEntry struct {
+	Cluster   string `json:"cluster"`
+	Context   string `json:"context,omitempty"`
+	Succeeded bool   `json:"succeeded"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// add records the results of a batch
+func (r *inventoryReport) add(results []register.BatchResult) {
+	for _, res := range results {
+		if res.Succeeded {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+		r.Clusters = append(r.Clusters, inventoryReportEntry{
+			Cluster:   res.Cluster,
+			Succeeded: res.Succeeded,
+			Error:     res.Error,
+			Duration:  res.Duration.Round(time.Second).String(),
+		})
+	}
+}
+
+// fail records a cluster which fails before its registration starts
+func (r *inventoryReport) fail(cluster string, err error) {
+	r.Failed++
+	r.Clusters = append(r.Clusters, inventoryReportEntry{Cluster: cluster, Error: err.Error()})
+}
+
+// skip records a context of kubeconfig which isn't registered
+func (r *inventoryReport) skip(c hub.KubeConfigContext, err error) {
+	r.Skipped++
+	r.Clusters = append(r.Clusters, inventoryReportEntry{Cluster: c.ClusterName, Context: c.Context, Skipped: true, Error: err.Error()})
+}
+
+// print prints the report as JSON, and returns the exit code of the run
+func (r *inventoryReport) print() int {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		klog.InfoS("Fail to encode the report", "err", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	if r.Failed != 0 {
+		return 1
+	}
+	return 0
+}
+
+func loadInventory(file string) (*inventory, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	inv := new(inventory)
+	if err = yaml.Unmarshal(data, inv); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, c := range inv.Clusters {
+		if len(c.Name) == 0 || len(c.CredentialSecret) == 0 {
+			return nil, fmt.Errorf("name and credentialSecret of every cluster are required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("cluster %s is listed more than once", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return inv, nil
+}
+
+// runInventory registers the spoke-clusters of the inventory file with a shared bootstrap token,
+// template is the registration options given by flags
+func runInventory(ctx context.Context, hubCluster *hub.Cluster, template register.Options, file string, workers int, timeout time.Duration) int {
+	inv, err := loadInventory(file)
+	if err != nil {
+		klog.InfoS("Fail to load inventory", "file", file, "err", err)
+		return 1
+	}
+
+	// an invalid cluster fails alone, the others are registered anyway
+	report := inventoryReport{}
+	var items []register.Options
+	for _, c := range inv.Clusters {
+		opts, err := inventoryOptions(ctx, hubCluster, template, c)
+		if err != nil {
+			klog.InfoS("Invalid cluster of inventory", "name", c.Name, "err", err)
+			report.fail(c.Name, err)
+			continue
+		}
+		items = append(items, opts)
+	}
+	if len(items) != 0 {
+		// the bootstrap RBAC is applied and the token is minted only once
+		hubKubeConfig, err := hubCluster.GenerateHubClusterKubeConfig(ctx, template.HubAPIServer)
+		if err != nil {
+			klog.InfoS("Fail to generate the token for spoke-clusters", "err", err)
+			return 1
+		}
+		for i := range items {
+			items[i].HubKubeConfig = hubKubeConfig
+		}
+		report.add(register.RunBatch(ctx, hubCluster, items, workers, timeout))
+	}
+	return report.print()
+}
+
+// inventoryOptions builds the registration options of an inventory cluster on top of template
+func inventoryOptions(ctx context.Context, hubCluster *hub.Cluster, template register.Options, c inventoryCluster) (register.Options, error) {
+	opts := template
+	opts.ClusterName = c.Name
+
+	namespace, name, err := splitNamespacedName(c.CredentialSecret)
+	if err != nil {
+		return opts, err
+	}
+	secret := new(corev1.Secret)
+	if err = hubCluster.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return opts, fmt.Errorf("fail to get credential secret: %w", err)
+	}
+	if opts.SpokeConfig, err = spokeConfigFromSecret(secret); err != nil {
+		return opts, err
+	}
+
+	opts.Accept.Labels = mergeMap(template.Accept.Labels, c.Labels)
+	opts.Accept.Annotations = mergeMap(template.Accept.Annotations, c.Annotations)
+	taints, err := hub.ParseTaints(c.Taints)
+	if err != nil {
+		return opts, err
+	}
+	// the slices of template are shared by every cluster, never append to them in place
+	opts.Accept.Taints = append(opts.Accept.Taints[:len(opts.Accept.Taints):len(opts.Accept.Taints)], taints...)
+	if len(c.ClusterSet) != 0 {
+		opts.ClusterSet = c.ClusterSet
+		if opts.ClusterSetBindings, err = hub.ParseNamespaces(c.ClusterSetBinding); err != nil {
+			return opts, err
+		}
+	}
+	opts.Claims = mergeMap(template.Claims, c.Claims)
+	addons, err := hub.ParseAddons(c.Addons)
+	if err != nil {
+		return opts, err
+	}
+	opts.Addons = append(opts.Addons[:len(opts.Addons):len(opts.Addons)], addons...)
+	return opts, nil
+}
+
+// spokeConfigFromSecret builds the rest config of spoke-cluster from a secret in the format of the cluster secret
+func spokeConfigFromSecret(secret *corev1.Secret) (*rest.Config, error) {
+	o := options{spokeInfo: spoke.SpokeInfo{
+		KubeConfig: string(secret.Data["kubeconfig"]),
+		APIServer:  string(secret.Data["api_server_internet"]),
+		CACert:     string(secret.Data["cluster_ca_cert"]),
+		ClientCert: string(secret.Data["client_cert"]),
+		ClientKey:  string(secret.Data["client_key"]),
+	}}
+	if len(strings.TrimSpace(o.spokeInfo.KubeConfig)) == 0 && len(o.spokeInfo.APIServer) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has neither kubeconfig nor api_server_internet", secret.Namespace, secret.Name)
+	}
+	return o.spokeConfig()
+}
+
+func mergeMap(base, override map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range override {
+		res[k] = v
+	}
+	return res
+}
@@ -4,105 +4,493 @@ import (
 	"context"
 	"encoding/base64"
 	"flag"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 
+	"github.com/oam-dev/cluster-register/pkg/common"
 	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
 	"github.com/oam-dev/cluster-register/pkg/spoke"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
 )
 
-func main() {
-	var clusterName string
-	var hubIP string
-	var decode bool
-	var spokeInfo spoke.SpokeInfo
-	flag.StringVar(&hubIP, "hub-api-server", "", "external apiserver address of hub cluster")
-	flag.StringVar(&clusterName, "cluster-name", "", "name of managed cluster")
-	flag.StringVar(&spokeInfo.CACert, "cluster-ca-cert", "", "ca certificate of managed cluster")
-	flag.StringVar(&spokeInfo.ClientCert, "client-cert", "", "ca certificate of client for TLS auth")
-	flag.StringVar(&spokeInfo.ClientKey, "client-key", "", "key of client for TLS auth")
-	flag.StringVar(&spokeInfo.APIServer, "api-server-internet", "", "external apiserver address of managed cluster")
-	flag.StringVar(&spokeInfo.KubeConfig, "kube-config", "", "kubeconfig of managed cluster")
-	flag.BoolVar(&decode, "decode", false, "decode the parameter")
+// options are the flags shared by registering and rendering
+type options struct {
+	clusterName       string
+	hubIP             string
+	decode            bool
+	resourceDir       string
+	resourceConfigMap string
+	labels            string
+	annotations       string
+	taints            string
+	clusterSet        string
+	clusterSetBinding string
+	claim             stringSlice
+	claims            string
+	addon             stringSlice
+	addons            string
+	baselineDir       string
+	baselineConfigMap string
+	waitBaseline      bool
+	spokeInfo         spoke.SpokeInfo
+}
 
-	flag.Parse()
+func (o *options) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.hubIP, "hub-api-server", "", "external apiserver address of hub cluster")
+	fs.StringVar(&o.clusterName, "cluster-name", "", "name of managed cluster")
+	fs.StringVar(&o.spokeInfo.CACert, "cluster-ca-cert", "", "ca certificate of managed cluster")
+	fs.StringVar(&o.spokeInfo.ClientCert, "client-cert", "", "ca certificate of client for TLS auth")
+	fs.StringVar(&o.spokeInfo.ClientKey, "client-key", "", "key of client for TLS auth")
+	fs.StringVar(&o.spokeInfo.APIServer, "api-server-internet", "", "external apiserver address of managed cluster")
+	fs.StringVar(&o.spokeInfo.KubeConfig, "kube-config", "", "kubeconfig of managed cluster")
+	fs.BoolVar(&o.decode, "decode", false, "decode the parameter")
+	fs.StringVar(&o.resourceDir, "resource-dir", "", "directory of manifests which replace or patch the embedded resources")
+	fs.StringVar(&o.labels, "labels", "", "labels of managed cluster, in the form of k1=v1,k2=v2")
+	fs.StringVar(&o.annotations, "annotations", "", "annotations of managed cluster, in the form of k1=v1,k2=v2")
+	fs.StringVar(&o.taints, "taints", "", "taints of managed cluster, in the form of key1=value1:NoSelect,key2:PreferNoSelect")
+	fs.StringVar(&o.clusterSet, "cluster-set", "", "ManagedClusterSet to join the managed cluster to, it is created if it doesn't exist")
+	fs.StringVar(&o.clusterSetBinding, "cluster-set-binding", "", "namespaces to bind the ManagedClusterSet to, in the form of ns1,ns2")
+	fs.Var(&o.claim, "claim", "ClusterClaim created on managed cluster in the form of name=value, the value may contain commas, can be repeated")
+	fs.StringVar(&o.claims, "claims", "", "Deprecated: use --claim instead. ClusterClaims created on managed cluster, in the form of name1=value1,name2=value2")
+	fs.Var(&o.addon, "addon", "OCM add-on enabled on managed cluster in the form of name[=installNamespace], can be repeated")
+	fs.StringVar(&o.addons, "addons", "", "Deprecated: use --addon instead. OCM add-ons enabled on managed cluster, in the form of name1=installNamespace1,name2")
+	fs.StringVar(&o.baselineDir, "baseline-dir", "", "directory of manifests delivered to managed cluster through ManifestWorks once it is available")
+	fs.StringVar(&o.baselineConfigMap, "baseline-configmap", "", "<namespace>/<name> of a ConfigMap on hub cluster of manifests delivered to managed cluster through ManifestWorks")
+	fs.BoolVar(&o.waitBaseline, "wait-baseline", false, "wait for the baseline ManifestWorks to be applied")
+	fs.StringVar(&o.resourceConfigMap, "resource-configmap", "", "<namespace>/<name> of a ConfigMap on hub cluster which replaces or patches the embedded resources")
+}
 
-	if decode {
-		clusterName = DecodeParameter(clusterName)
-		spokeInfo.CACert = DecodeParameter(spokeInfo.CACert)
-		spokeInfo.ClientCert = DecodeParameter(spokeInfo.ClientCert)
-		spokeInfo.ClientKey = DecodeParameter(spokeInfo.ClientKey)
-		spokeInfo.APIServer = DecodeParameter(spokeInfo.APIServer)
-		spokeInfo.KubeConfig = DecodeParameter(spokeInfo.KubeConfig)
+func (o *options) decodeParameters() {
+	if !o.decode {
+		return
 	}
+	o.clusterName = DecodeParameter(o.clusterName)
+	o.spokeInfo.CACert = DecodeParameter(o.spokeInfo.CACert)
+	o.spokeInfo.ClientCert = DecodeParameter(o.spokeInfo.ClientCert)
+	o.spokeInfo.ClientKey = DecodeParameter(o.spokeInfo.ClientKey)
+	o.spokeInfo.APIServer = DecodeParameter(o.spokeInfo.APIServer)
+	o.spokeInfo.KubeConfig = DecodeParameter(o.spokeInfo.KubeConfig)
+	o.labels = DecodeParameter(o.labels)
+	o.annotations = DecodeParameter(o.annotations)
+	o.taints = DecodeParameter(o.taints)
+	o.resourceDir = DecodeParameter(o.resourceDir)
+	o.resourceConfigMap = DecodeParameter(o.resourceConfigMap)
+	o.clusterSet = DecodeParameter(o.clusterSet)
+	o.clusterSetBinding = DecodeParameter(o.clusterSetBinding)
+	for i := range o.claim {
+		o.claim[i] = DecodeParameter(o.claim[i])
+	}
+	o.claims = DecodeParameter(o.claims)
+	for i := range o.addon {
+		o.addon[i] = DecodeParameter(o.addon[i])
+	}
+	o.addons = DecodeParameter(o.addons)
+	o.baselineDir = DecodeParameter(o.baselineDir)
+	o.baselineConfigMap = DecodeParameter(o.baselineConfigMap)
+}
 
-	ctx := context.Background()
+// acceptOptions parses the labels, annotations and taints of managed cluster
+func (o *options) acceptOptions() (hub.AcceptOptions, error) {
+	var accept hub.AcceptOptions
+	var err error
+	if accept.Labels, err = hub.ParseLabels(o.labels); err != nil {
+		return accept, err
+	}
+	if accept.Annotations, err = hub.ParseKeyValues(o.annotations); err != nil {
+		return accept, err
+	}
+	if accept.Taints, err = hub.ParseTaints(o.taints); err != nil {
+		return accept, err
+	}
+	return accept, nil
+}
 
-	// 1. connect to hub-cluster, which job(ocm-register-assistant) was deployed to
-	hubCluster, err := hub.NewHubCluster(nil)
+// parseClaims parses the ClusterClaims of --claims and --claim, the repeated flag takes precedence
+func (o *options) parseClaims() (map[string]string, error) {
+	claims, err := spoke.ParseClaims(o.claims)
 	if err != nil {
-		klog.InfoS("Fail to create client connect to hub cluster")
-		os.Exit(1)
+		return nil, err
+	}
+	for _, item := range o.claim {
+		name, value, err := spoke.ParseClaim(item)
+		if err != nil {
+			return nil, err
+		}
+		claims[name] = value
 	}
+	return claims, nil
+}
 
-	var spokeConfig *rest.Config
-	if len(spokeInfo.KubeConfig) != 0 {
-		spokeConfig, err = hubCluster.GetSpokeClusterConfig(spokeInfo.KubeConfig)
-		if err != nil || spokeConfig == nil {
-			klog.InfoS("Fail to get spoke-cluster kubeconfig", "err", err)
-			os.Exit(1)
+// parseAddons parses the add-ons of --addons and --addon, in order
+func (o *options) parseAddons() ([]hub.Addon, error) {
+	addons, err := hub.ParseAddons(o.addons)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range o.addon {
+		addon, err := hub.ParseAddon(item)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		legoConfig := spokeInfo.CreateKubeConfig()
-		spokeConfig, err = hub.ConvertSpokeKubeConfig(&legoConfig)
-		if err != nil || spokeConfig == nil {
-			klog.InfoS("Fail to convert spoke-cluster kubeconfig", "err", err)
+		addons = append(addons, addon)
+	}
+	return addons, nil
+}
+
+// clusterSetBindings parses the namespaces the ManagedClusterSet is bound to
+func (o *options) clusterSetBindings() ([]string, error) {
+	namespaces, err := hub.ParseNamespaces(o.clusterSetBinding)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) != 0 && len(o.clusterSet) == 0 {
+		return nil, fmt.Errorf("cluster-set-binding requires cluster-set")
+	}
+	return namespaces, nil
+}
+
+// spokeConfig builds the rest config of spoke-cluster, it doesn't contact the spoke-cluster
+func (o *options) spokeConfig() (*rest.Config, error) {
+	if len(o.spokeInfo.KubeConfig) != 0 {
+		return hub.LoadSpokeKubeConfig(o.spokeInfo.KubeConfig)
+	}
+	legoConfig := o.spokeInfo.CreateKubeConfig()
+	return hub.ConvertSpokeKubeConfig(&legoConfig)
+}
+
+// addTracingFlags adds the flags of where the spans are exported to
+func addTracingFlags(fs *flag.FlagSet, o *tracing.Options) {
+	fs.StringVar(&o.OTLPEndpoint, "otlp-endpoint", "", "url of an OTLP/HTTP collector the spans of the registration are exported to, e.g. http://otel-collector:4318")
+	fs.StringVar(&o.File, "trace-file", "", "local file the spans of the registration are written to as JSON")
+}
+
+// setupTracing installs the exporters of the spans, the returned flush has to be called before exit
+func setupTracing(ctx context.Context, o tracing.Options) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		// the spans are flushed even if ctx is canceled, e.g. by SIGTERM
+		if err := shutdown(context.WithoutCancel(ctx)); err != nil {
+			klog.InfoS("Fail to flush spans", "err", err)
+		}
+	}, nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "import-from-vela":
+			os.Exit(runImportFromVela(os.Args[2:]))
+		case "reconcile":
+			os.Exit(runReconcile(os.Args[2:]))
+		case "diagnose":
+			os.Exit(runDiagnose(os.Args[2:]))
+		case "register":
+			// the same as no subcommand
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
+	var opts options
+	var dryRun string
+	var diff bool
+	var restart bool
+	var rollbackOnFailure bool
+	var takeover bool
+	var preProvision bool
+	var leaseDurationSeconds int
+	var verify bool
+	var backendName string
+	var credentialType string
+	var gatewayClusterRole string
+	var inventoryFile string
+	var contexts string
+	var workers int
+	var clusterTimeout time.Duration
+	var report reportOptions
+	var pushgateway string
+	var traceOpts tracing.Options
+	opts.addFlags(flag.CommandLine)
+	flag.StringVar(&dryRun, "dry-run", "", "must be \"server\" or empty, if server, every create, update and approval is sent as a server-side dry-run")
+	flag.BoolVar(&diff, "diff", false, "print the diff between the live and the rendered resources of hub and spoke cluster, without changing them")
+	flag.BoolVar(&restart, "restart", false, "ignore the phases completed by previous runs and register from scratch")
+	flag.BoolVar(&takeover, "takeover", false, "register the spoke cluster even if it is joined to another hub cluster, its agents re-bootstrap with this hub")
+	flag.BoolVar(&preProvision, "pre-provision", false, "create the accepted ManagedCluster on hub cluster before the spoke cluster joins")
+	flag.IntVar(&leaseDurationSeconds, "lease-duration-seconds", 0, "lease duration seconds of the pre-provisioned ManagedCluster")
+	flag.BoolVar(&verify, "verify", false, "verify the work agent of the registered cluster with a smoke test ManifestWork")
+	flag.StringVar(&backendName, "backend", register.BackendOCM, "how the cluster is registered, ocm or cluster-gateway")
+	flag.StringVar(&credentialType, "credential-type", "", "credential of the cluster-gateway backend, ServiceAccountToken or X509Certificate")
+	flag.StringVar(&gatewayClusterRole, "gateway-cluster-role", "", "ClusterRole bound to cluster-gateway on managed cluster, e.g. cluster-admin, the embedded role which only impersonates the requesting identity if empty")
+	flag.BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "delete the objects created and restore the objects updated by this run if the registration fails")
+	flag.StringVar(&inventoryFile, "inventory", "", "yaml file listing the clusters to register, with a credential secret each, instead of a single cluster")
+	flag.StringVar(&contexts, "contexts", "", "register every context of kube-config matching the regular expression as a cluster named after the context, e.g. '.*' for all of them")
+	flag.IntVar(&workers, "workers", 4, "number of clusters of the inventory or contexts registered at the same time")
+	flag.DurationVar(&clusterTimeout, "cluster-timeout", 20*time.Minute, "timeout of registering each cluster of the inventory or contexts")
+	flag.StringVar(&report.terminationLog, "termination-log", "/dev/termination-log", "file the JSON result of the registration is written to as the termination message, skipped if it doesn't exist")
+	flag.StringVar(&report.configMap, "report-configmap", "", "<namespace>/<name> of a ConfigMap on hub cluster the JSON result of the registration is written to, keyed by <cluster>.json")
+	flag.StringVar(&report.secret, "report-secret", "", "<namespace>/<name> of a Secret on hub cluster, e.g. the source of the credential, the JSON result is written to its annotation")
+	flag.StringVar(&pushgateway, "pushgateway", "", "url of a Pushgateway compatible endpoint the metrics are pushed to at exit")
+	addTracingFlags(flag.CommandLine, &traceOpts)
+	flag.Parse()
+	opts.decodeParameters()
+
+	if dryRun != "" && dryRun != "server" {
+		klog.InfoS("Unsupported dry-run mode", "mode", dryRun)
+		os.Exit(1)
+	}
+	if diff && backendName != register.BackendOCM {
+		klog.InfoS("Diff is only supported by the ocm backend", "backend", backendName)
+		os.Exit(1)
+	}
+	if backendName != register.BackendOCM {
+		// the definition passes every flag, only the flags given a value are refused
+		ocmOnly := map[string]bool{
+			"taints":                 len(opts.taints) != 0,
+			"cluster-set":            len(opts.clusterSet) != 0,
+			"cluster-set-binding":    len(opts.clusterSetBinding) != 0,
+			"claim":                  len(opts.claim) != 0,
+			"claims":                 len(opts.claims) != 0,
+			"addon":                  len(opts.addon) != 0,
+			"addons":                 len(opts.addons) != 0,
+			"baseline-dir":           len(opts.baselineDir) != 0,
+			"baseline-configmap":     len(opts.baselineConfigMap) != 0,
+			"wait-baseline":          opts.waitBaseline,
+			"verify":                 verify,
+			"pre-provision":          preProvision,
+			"lease-duration-seconds": leaseDurationSeconds != 0,
+			"restart":                restart,
+			"takeover":               takeover,
+		}
+		var given []string
+		for name, set := range ocmOnly {
+			if set {
+				given = append(given, "--"+name)
+			}
+		}
+		if len(given) != 0 {
+			sort.Strings(given)
+			klog.InfoS("Flags only supported by the ocm backend", "backend", backendName, "flags", given)
 			os.Exit(1)
 		}
 	}
+	if len(inventoryFile) != 0 && (diff || backendName != register.BackendOCM) {
+		klog.InfoS("Inventory is only supported by the ocm backend without diff", "backend", backendName)
+		os.Exit(1)
+	}
+	if len(contexts) != 0 && (len(inventoryFile) != 0 || len(opts.spokeInfo.KubeConfig) == 0 || diff || backendName != register.BackendOCM) {
+		klog.InfoS("Contexts require kube-config, and are only supported by the ocm backend without inventory or diff", "backend", backendName)
+		os.Exit(1)
+	}
 
-	klog.Info("generate the token for spoke-cluster to connect hub-cluster")
-	hubKubeConfig, err := hubCluster.GenerateHubClusterKubeConfig(ctx, hubIP)
+	accept, err := opts.acceptOptions()
 	if err != nil {
-		klog.InfoS("Fail to generate the token for spoke-cluster", "err", err)
+		klog.InfoS("Invalid metadata of managed cluster", "err", err)
 		os.Exit(1)
 	}
-
-	// 2. connect to spoke-cluster
-	spokeCluster, err := spoke.NewSpokeCluster(clusterName, spokeConfig, hubKubeConfig)
+	clusterSetBindings, err := opts.clusterSetBindings()
 	if err != nil {
-		klog.InfoS("Fail to connect spoke cluster", "err", err)
+		klog.InfoS("Invalid cluster set of managed cluster", "err", err)
 		os.Exit(1)
 	}
-
-	klog.InfoS("prepare the env for spoke-cluster", "name", clusterName)
-	err = spokeCluster.InitSpokeClusterEnv(ctx)
+	claims, err := opts.parseClaims()
 	if err != nil {
-		klog.InfoS("Fail to prepare the env for spoke-cluster", "err", err)
+		klog.InfoS("Invalid claims of managed cluster", "err", err)
 		os.Exit(1)
 	}
-
-	klog.Info("wait for spoke-cluster register request")
-	ready, err := hubCluster.WaitForSpokeClusterReady(ctx, clusterName)
-	if err != nil || !ready {
-		klog.Error(err, "Fail to waiting for register request")
+	addons, err := opts.parseAddons()
+	if err != nil {
+		klog.InfoS("Invalid addons of managed cluster", "err", err)
 		os.Exit(1)
 	}
 
-	klog.Info("approve spoke cluster csr")
-	err = hubCluster.RegisterSpokeCluster(ctx, spokeCluster.Name)
+	ctx := context.Background()
+
+	flushSpans, err := setupTracing(ctx, traceOpts)
 	if err != nil {
-		klog.Error(err, "Fail to approve spoke cluster")
+		klog.InfoS("Fail to set up tracing", "err", err)
 		os.Exit(1)
 	}
-	klog.InfoS("successfully register cluster", "name", clusterName)
+	// the spans are flushed before exit
+	exit := func(code int) {
+		flushSpans()
+		os.Exit(code)
+	}
+
+	// 1. connect to hub-cluster, which job(ocm-register-assistant) was deployed to
+	hubCluster, err := hub.NewHubCluster(nil)
+	if err != nil {
+		klog.InfoS("Fail to create client connect to hub cluster")
+		exit(1)
+	}
+	hubCluster.Recorder = hub.NewEventRecorder(hubCluster.Client)
+
+	overrides, err := loadOverrides(ctx, hubCluster, opts.resourceDir, opts.resourceConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load resource overrides", "err", err)
+		exit(1)
+	}
+	hubCluster.Overrides = overrides
 
-	os.Exit(0)
+	baseline, err := loadBaseline(ctx, hubCluster, opts.baselineDir, opts.baselineConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load baseline manifests", "err", err)
+		exit(1)
+	}
+
+	registerOpts := register.Options{
+		ClusterName:  opts.clusterName,
+		HubAPIServer: opts.hubIP,
+		Overrides:    overrides,
+		// diff never changes the clusters, the token isn't minted either
+		DryRun:               dryRun == "server" || diff,
+		Restart:              restart,
+		RollbackOnFailure:    rollbackOnFailure,
+		Takeover:             takeover,
+		Accept:               accept,
+		PreProvision:         preProvision,
+		LeaseDurationSeconds: int32(leaseDurationSeconds),
+		ClusterSet:           opts.clusterSet,
+		ClusterSetBindings:   clusterSetBindings,
+		Claims:               claims,
+		Addons:               addons,
+		Verify:               verify,
+		Baseline:             baseline,
+		WaitBaseline:         opts.waitBaseline,
+		CredentialType:       credentialType,
+		GatewayClusterRole:   gatewayClusterRole,
+	}
+	if diff {
+		registerOpts.Until = register.PhaseHubToken
+	}
+	if registerOpts.DryRun {
+		hubCluster.EnableDryRun()
+	}
+
+	registerClusterMetrics(hubCluster)
+	if len(inventoryFile) != 0 {
+		code := runInventory(ctx, hubCluster, registerOpts, inventoryFile, workers, clusterTimeout)
+		pushMetrics(pushgateway, "")
+		exit(code)
+	}
+	if len(contexts) != 0 {
+		code := runContexts(ctx, hubCluster, registerOpts, opts.spokeInfo.KubeConfig, contexts, workers, clusterTimeout)
+		pushMetrics(pushgateway, "")
+		exit(code)
+	}
+
+	registerOpts.SpokeConfig, err = opts.spokeConfig()
+	if err != nil || registerOpts.SpokeConfig == nil {
+		klog.InfoS("Fail to get spoke-cluster kubeconfig", "err", err)
+		exit(1)
+	}
+
+	// 2. register spoke-cluster with the backend
+	backend, err := register.NewBackend(backendName, hubCluster, registerOpts)
+	if err != nil {
+		klog.InfoS("Fail to create registration backend", "err", err)
+		exit(1)
+	}
+	runCtx, span := tracing.Start(ctx, "cluster-register", attribute.String("cluster", opts.clusterName), attribute.String("backend", backendName))
+	err = backend.Run(runCtx)
+	tracing.End(span, err)
+	result := backend.Result()
+	reportTrackedObjects(result.Tracker)
+	if !diff {
+		writeReport(ctx, hubCluster, report, register.NewReport(opts.clusterName, backendName, result, err))
+		pushMetrics(pushgateway, opts.clusterName)
+	}
+	if err != nil {
+		klog.InfoS("Fail to register spoke cluster", tracing.LogValues(runCtx, "name", opts.clusterName, "backend", backendName, "err", err)...)
+		exit(1)
+	}
+
+	if diff {
+		registration := backend.(*register.Registration)
+		if err = printDiff(ctx, registration.Hub, registration.Spoke); err != nil {
+			klog.InfoS("Fail to diff the resources", "err", err)
+			exit(1)
+		}
+		exit(0)
+	}
+	if verified := result.VerifyResult; verified != nil {
+		klog.InfoS("smoke test passed", "applied", verified.Applied, "available", verified.Available, "feedback", verified.Feedback)
+	}
+	reportAddonStatus(result.AddonStatus)
+	klog.InfoS("successfully register cluster", tracing.LogValues(runCtx, "name", opts.clusterName, "backend", backendName, "dryRun", registerOpts.DryRun)...)
+
+	exit(0)
+}
+
+// reportAddonStatus logs the health of the add-ons enabled by the registration
+func reportAddonStatus(statuses []hub.AddonStatus) {
+	for _, status := range statuses {
+		if status.Available {
+			klog.InfoS("addon is available", "name", status.Name)
+			continue
+		}
+		klog.InfoS("addon isn't available yet", "name", status.Name, "message", status.Message)
+	}
+}
+
+// reportTrackedObjects logs the objects changed by the registration
+func reportTrackedObjects(tracker *common.Tracker) {
+	for _, o := range tracker.Objects() {
+		klog.InfoS("touched object", "cluster", o.Cluster, "action", o.Action, "kind", o.Kind, "object", o.Name, "rolledBack", o.RolledBack)
+	}
 }
 
 func DecodeParameter(data string) string {
 	decode, _ := base64.StdEncoding.DecodeString(data)
 	return string(decode)
 }
+
+func loadOverrides(ctx context.Context, hubCluster *hub.Cluster, dir string, configMap string) (*common.Overrides, error) {
+	if len(dir) != 0 {
+		return common.LoadOverridesFromDir(dir)
+	}
+	if len(configMap) != 0 {
+		namespace, name, err := splitNamespacedName(configMap)
+		if err != nil {
+			return nil, err
+		}
+		return common.LoadOverridesFromConfigMap(ctx, hubCluster.Client, namespace, name)
+	}
+	return nil, nil
+}
+
+// loadBaseline reads the baseline manifests from a local directory or a ConfigMap of hub-cluster
+func loadBaseline(ctx context.Context, hubCluster *hub.Cluster, dir string, configMap string) (map[string][]byte, error) {
+	if len(dir) != 0 {
+		return common.ReadManifestDir(dir)
+	}
+	if len(configMap) != 0 {
+		namespace, name, err := splitNamespacedName(configMap)
+		if err != nil {
+			return nil, err
+		}
+		return common.ReadManifestConfigMap(ctx, hubCluster.Client, namespace, name)
+	}
+	return nil, nil
+}
+
+func splitNamespacedName(s string) (string, string, error) {
+	namespace, name, found := strings.Cut(s, "/")
+	if !found || len(namespace) == 0 || len(name) == 0 {
+		return "", "", fmt.Errorf("invalid name %q, expect <namespace>/<name>", s)
+	}
+	return namespace, name, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/metrics"
+)
+
+// metricsJob is the job label of the metrics pushed to Pushgateway
+const metricsJob = "cluster-register"
+
+// registerClusterMetrics adds the gauge of the ManagedClusters of hub-cluster to the metrics
+func registerClusterMetrics(hubCluster *hub.Cluster) {
+	err := metrics.RegisterManagedClusters(func(ctx context.Context) ([]ocmclusterv1.ManagedCluster, error) {
+		return hubCluster.ListManagedClusters(ctx, "")
+	})
+	if err != nil {
+		klog.InfoS("Fail to register the metrics of managed clusters", "err", err)
+	}
+}
+
+// pushMetrics pushes the metrics to Pushgateway at the exit of a Job, nothing is pushed if url is empty
+func pushMetrics(url, cluster string) {
+	if len(url) == 0 {
+		return
+	}
+	if err := metrics.Push(url, metricsJob, cluster); err != nil {
+		klog.InfoS("Fail to push metrics", "url", url, "err", err)
+		return
+	}
+	klog.InfoS("pushed metrics", "url", url)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// runMigrate moves a registered spoke-cluster to another hub-cluster, or renames it within the hub-cluster
+func runMigrate(args []string) int {
+	var opts options
+	var newName string
+	var targetKubeConfig string
+	var rollbackOnFailure bool
+	var traceOpts tracing.Options
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	opts.addFlags(fs)
+	addTracingFlags(fs, &traceOpts)
+	fs.StringVar(&newName, "new-name", "", "name of managed cluster on the target hub cluster, the same as cluster-name if empty")
+	fs.StringVar(&targetKubeConfig, "target-kube-config", "", "kubeconfig of target hub cluster, the cluster is renamed within the current hub cluster if empty")
+	fs.BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "delete the objects created and restore the objects updated by this run if the migration fails")
+	_ = fs.Parse(args)
+	opts.decodeParameters()
+	if opts.decode {
+		newName = DecodeParameter(newName)
+		targetKubeConfig = DecodeParameter(targetKubeConfig)
+	}
+	if len(newName) == 0 {
+		newName = opts.clusterName
+	}
+
+	accept, err := opts.acceptOptions()
+	if err != nil {
+		klog.InfoS("Invalid metadata of managed cluster", "err", err)
+		return 1
+	}
+	clusterSetBindings, err := opts.clusterSetBindings()
+	if err != nil {
+		klog.InfoS("Invalid cluster set of managed cluster", "err", err)
+		return 1
+	}
+	claims, err := opts.parseClaims()
+	if err != nil {
+		klog.InfoS("Invalid claims of managed cluster", "err", err)
+		return 1
+	}
+	addons, err := opts.parseAddons()
+	if err != nil {
+		klog.InfoS("Invalid addons of managed cluster", "err", err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	flushSpans, err := setupTracing(ctx, traceOpts)
+	if err != nil {
+		klog.InfoS("Fail to set up tracing", "err", err)
+		return 1
+	}
+	defer flushSpans()
+
+	sourceHub, err := hub.NewHubCluster(nil)
+	if err != nil {
+		klog.InfoS("Fail to create client connect to hub cluster", "err", err)
+		return 1
+	}
+	targetHub := sourceHub
+	if len(targetKubeConfig) != 0 {
+		targetConfig, err := hub.LoadSpokeKubeConfig(targetKubeConfig)
+		if err != nil {
+			klog.InfoS("Fail to get target hub-cluster kubeconfig", "err", err)
+			return 1
+		}
+		if targetHub, err = hub.NewHubCluster(targetConfig); err != nil {
+			klog.InfoS("Fail to create client connect to target hub cluster", "err", err)
+			return 1
+		}
+	}
+
+	overrides, err := loadOverrides(ctx, sourceHub, opts.resourceDir, opts.resourceConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load resource overrides", "err", err)
+		return 1
+	}
+	targetHub.Overrides = overrides
+
+	baseline, err := loadBaseline(ctx, sourceHub, opts.baselineDir, opts.baselineConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load baseline manifests", "err", err)
+		return 1
+	}
+
+	spokeConfig, err := opts.spokeConfig()
+	if err != nil || spokeConfig == nil {
+		klog.InfoS("Fail to get spoke-cluster kubeconfig", "err", err)
+		return 1
+	}
+
+	err = register.Migrate(ctx, sourceHub, targetHub, register.MigrateOptions{
+		Options: register.Options{
+			ClusterName:        newName,
+			HubAPIServer:       opts.hubIP,
+			SpokeConfig:        spokeConfig,
+			Overrides:          overrides,
+			RollbackOnFailure:  rollbackOnFailure,
+			Accept:             accept,
+			ClusterSet:         opts.clusterSet,
+			ClusterSetBindings: clusterSetBindings,
+			Claims:             claims,
+			Addons:             addons,
+			Baseline:           baseline,
+			WaitBaseline:       opts.waitBaseline,
+		},
+		SourceName: opts.clusterName,
+	})
+	if err != nil {
+		klog.InfoS("Fail to migrate managed cluster", "name", opts.clusterName, "err", err)
+		return 1
+	}
+	klog.InfoS("successfully migrate cluster", "from", opts.clusterName, "to", newName)
+	return 0
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghodss/yaml"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/metrics"
+	"github.com/oam-dev/cluster-register/pkg/register"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// watchDebounce is how long the changes of the directory settle before it is reconciled
+var watchDebounce = 2 * time.Second
+
+// specHashAnnotation records the hash of the cluster file and the registration options a ManagedCluster was last
+// reconciled with.
+// The ManagedClusters with it are owned by the reconciler, and are pruned once their files are removed.
+const specHashAnnotation = "cluster-register.oam.dev/spec-hash"
+
+// clusterFile is a cluster definition of the reconciled directory
+type clusterFile struct {
+	file    string
+	hash    string
+	cluster inventoryCluster
+	err     error
+}
+
+// runReconcile registers, updates and unregisters clusters according to the cluster files of a directory,
+// one yaml file per cluster in the same format as an inventory cluster
+func runReconcile(args []string) int {
+	var opts options
+	var dir string
+	var interval time.Duration
+	var prune bool
+	var once bool
+	var clusterTimeout time.Duration
+	var metricsAddr string
+	var rollbackOnFailure bool
+	var takeover bool
+	var preProvision bool
+	var leaseDurationSeconds int
+	var verify bool
+	var traceOpts tracing.Options
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	opts.addFlags(fs)
+	addTracingFlags(fs, &traceOpts)
+	fs.StringVar(&dir, "dir", "", "directory of the cluster files, one yaml file per cluster")
+	fs.DurationVar(&interval, "interval", time.Minute, "interval between two full reconciliations of the directory, which is also reconciled whenever it changes")
+	fs.BoolVar(&prune, "prune", false, "unregister the clusters whose files are removed from hub cluster, the agents on the managed clusters are left")
+	fs.BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "delete the objects created and restore the objects updated for a cluster if its reconciliation fails")
+	fs.BoolVar(&takeover, "takeover", false, "register the spoke clusters even if they are joined to another hub cluster, their agents re-bootstrap with this hub")
+	fs.BoolVar(&preProvision, "pre-provision", false, "create the accepted ManagedClusters on hub cluster before the spoke clusters join")
+	fs.IntVar(&leaseDurationSeconds, "lease-duration-seconds", 0, "lease duration seconds of the pre-provisioned ManagedClusters")
+	fs.BoolVar(&verify, "verify", false, "verify the work agent of the registered clusters with a smoke test ManifestWork")
+	fs.BoolVar(&once, "once", false, "reconcile the directory once and exit")
+	fs.DurationVar(&clusterTimeout, "cluster-timeout", 20*time.Minute, "timeout of reconciling each cluster file")
+	fs.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "address the metrics are served on /metrics, disabled if empty")
+	_ = fs.Parse(args)
+	opts.decodeParameters()
+	if len(dir) == 0 {
+		klog.InfoS("The directory of cluster files is required")
+		return 1
+	}
+
+	accept, err := opts.acceptOptions()
+	if err != nil {
+		klog.InfoS("Invalid metadata of managed cluster", "err", err)
+		return 1
+	}
+	clusterSetBindings, err := opts.clusterSetBindings()
+	if err != nil {
+		klog.InfoS("Invalid cluster set of managed cluster", "err", err)
+		return 1
+	}
+	claims, err := opts.parseClaims()
+	if err != nil {
+		klog.InfoS("Invalid claims of managed cluster", "err", err)
+		return 1
+	}
+	addons, err := opts.parseAddons()
+	if err != nil {
+		klog.InfoS("Invalid addons of managed cluster", "err", err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	flushSpans, err := setupTracing(ctx, traceOpts)
+	if err != nil {
+		klog.InfoS("Fail to set up tracing", "err", err)
+		return 1
+	}
+	defer flushSpans()
+
+	hubCluster, err := hub.NewHubCluster(nil)
+	if err != nil {
+		klog.InfoS("Fail to create client connect to hub cluster", "err", err)
+		return 1
+	}
+	hubCluster.Recorder = hub.NewEventRecorder(hubCluster.Client)
+	registerClusterMetrics(hubCluster)
+	if len(metricsAddr) != 0 && !once {
+		go func() {
+			if err := metrics.Serve(ctx, metricsAddr); err != nil {
+				klog.InfoS("Fail to serve metrics", "addr", metricsAddr, "err", err)
+			}
+		}()
+	}
+	overrides, err := loadOverrides(ctx, hubCluster, opts.resourceDir, opts.resourceConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load resource overrides", "err", err)
+		return 1
+	}
+	hubCluster.Overrides = overrides
+	baseline, err := loadBaseline(ctx, hubCluster, opts.baselineDir, opts.baselineConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load baseline manifests", "err", err)
+		return 1
+	}
+	template := register.Options{
+		HubAPIServer:         opts.hubIP,
+		Overrides:            overrides,
+		RollbackOnFailure:    rollbackOnFailure,
+		Takeover:             takeover,
+		Accept:               accept,
+		PreProvision:         preProvision,
+		LeaseDurationSeconds: int32(leaseDurationSeconds),
+		ClusterSet:           opts.clusterSet,
+		ClusterSetBindings:   clusterSetBindings,
+		Claims:               claims,
+		Addons:               addons,
+		Verify:               verify,
+		Baseline:             baseline,
+		WaitBaseline:         opts.waitBaseline,
+	}
+
+	if once {
+		if reconcileDir(ctx, hubCluster, template, dir, prune, clusterTimeout) != 0 {
+			return 1
+		}
+		return 0
+	}
+	changes, err := watchDir(ctx, dir)
+	if err != nil {
+		klog.InfoS("Fail to watch the directory of cluster files", "dir", dir, "err", err)
+		return 1
+	}
+	for {
+		reconcileDir(ctx, hubCluster, template, dir, prune, clusterTimeout)
+		select {
+		case <-ctx.Done():
+			klog.InfoS("stop reconciling", "dir", dir)
+			return 0
+		case <-changes:
+			klog.InfoS("directory of cluster files is changed", "dir", dir)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchDir notifies the changes of the files of dir, a burst of changes is notified once.
+// The parent directory is watched as well, since dir may be a symlink swapped as a whole, e.g. by git-sync.
+func watchDir(ctx context.Context, dir string) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Clean(dir)
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if err = watcher.Add(d); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Dir(event.Name) != dir && event.Name != dir {
+					// the siblings of dir in the parent directory
+					continue
+				}
+				if event.Name == dir {
+					// the watch of a swapped symlink is on its previous target
+					_ = watcher.Remove(dir)
+					if err := watcher.Add(dir); err != nil {
+						klog.InfoS("Fail to watch the directory of cluster files", "dir", dir, "err", err)
+					}
+				}
+				debounce = time.After(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.InfoS("Fail to watch the directory of cluster files", "dir", dir, "err", err)
+			case <-debounce:
+				debounce = nil
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// reconcileDir reconciles the cluster files of dir in the order of file names, and returns the number of failures
+func reconcileDir(ctx context.Context, hubCluster *hub.Cluster, template register.Options, dir string, prune bool, timeout time.Duration) int {
+	files, err := readClusterFiles(dir)
+	if err != nil {
+		klog.InfoS("Fail to read cluster files", "dir", dir, "err", err)
+		return 1
+	}
+
+	failed := 0
+	invalid := 0
+	desired := map[string]bool{}
+	for _, f := range files {
+		// the cluster of an invalid file is still desired, it must never be pruned
+		desired[f.cluster.Name] = true
+		if f.err != nil {
+			failed++
+			invalid++
+			klog.InfoS("Invalid cluster file", "file", f.file, "err", f.err)
+			continue
+		}
+		clusterCtx, cancel := context.WithTimeout(ctx, timeout)
+		action, err := reconcileCluster(clusterCtx, hubCluster, template, f)
+		cancel()
+		if err != nil {
+			failed++
+			klog.InfoS("Fail to reconcile cluster file", "file", f.file, "name", f.cluster.Name, "action", action, "err", err)
+			continue
+		}
+		klog.InfoS("reconciled cluster file", "file", f.file, "name", f.cluster.Name, "action", action)
+	}
+
+	switch {
+	case prune && len(files) == 0:
+		// an empty directory is more likely a broken mount than the intent to unregister every cluster
+		klog.InfoS("Refuse to prune, no cluster file is found", "dir", dir)
+		failed++
+		prune = false
+	case prune && invalid != 0:
+		klog.InfoS("Skip pruning, some cluster files are invalid", "dir", dir, "invalid", invalid)
+		prune = false
+	}
+	owned, err := hubCluster.ListManagedClusters(ctx, specHashAnnotation)
+	if err != nil {
+		klog.InfoS("Fail to list managed clusters", "err", err)
+		return failed + 1
+	}
+	for _, mc := range owned {
+		if desired[mc.Name] {
+			continue
+		}
+		if !prune {
+			klog.InfoS("cluster file is removed, skip unregistering without prune", "name", mc.Name)
+			continue
+		}
+		// the credential of the cluster goes with its file, the agents on spoke-cluster lose their access to
+		// hub-cluster but aren't removed
+		if err = hubCluster.DeleteManagedCluster(ctx, mc.Name); err != nil {
+			failed++
+			klog.InfoS("Fail to unregister cluster", "name", mc.Name, "err", err)
+			continue
+		}
+		klog.InfoS("reconciled cluster file", "name", mc.Name, "action", "unregistered", "scope", "hub")
+	}
+	return failed
+}
+
+// reconcileCluster registers the cluster of the file, or updates it if it is registered with another version
+// of the file. Nothing is done if neither the file nor the registration options, e.g. the flags and the content of
+// the credential secret, are changed since the last successful reconciliation.
+func reconcileCluster(ctx context.Context, hubCluster *hub.Cluster, template register.Options, f clusterFile) (string, error) {
+	mc, err := hubCluster.GetManagedCluster(ctx, f.cluster.Name)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return "get", err
+	}
+	found := err == nil
+	opts, err := inventoryOptions(ctx, hubCluster, template, f.cluster)
+	if err != nil {
+		return "load", err
+	}
+	hash, err := specHash(f, opts)
+	if err != nil {
+		return "load", err
+	}
+	if found && mc.Annotations[specHashAnnotation] == hash {
+		return "unchanged", nil
+	}
+
+	// every registration records its own changes, the client is shared
+	hubCopy := *hubCluster
+	registration := register.NewRegistration(&hubCopy, opts)
+
+	action := "registered"
+	if mc != nil && mc.Spec.HubAcceptsClient && meta.IsStatusConditionTrue(mc.Status.Conditions, ocmclusterv1.ManagedClusterConditionAvailable) {
+		action = "updated"
+		err = registration.Update(ctx)
+	} else {
+		err = registration.Run(ctx)
+	}
+	if err != nil {
+		return action, err
+	}
+	return action, hubCluster.SetManagedClusterAnnotation(ctx, f.cluster.Name, specHashAnnotation, hash)
+}
+
+// specHash hashes the cluster file together with the effective registration options, i.e. the flags and the
+// credential of the cluster, so the cluster is reconciled again once any of them changes
+func specHash(f clusterFile, opts register.Options) (string, error) {
+	spec := struct {
+		File                 string
+		HubAPIServer         string
+		Overrides            *common.Overrides
+		Accept               hub.AcceptOptions
+		ClusterSet           string
+		ClusterSetBindings   []string
+		Claims               map[string]string
+		Addons               []hub.Addon
+		Verify               bool
+		Baseline             map[string][]byte
+		WaitBaseline         bool
+		PreProvision         bool
+		LeaseDurationSeconds int32
+		Server               string
+		CAData               []byte
+		CertData             []byte
+		KeyData              []byte
+		BearerToken          string
+	}{
+		File:                 f.hash,
+		HubAPIServer:         opts.HubAPIServer,
+		Overrides:            opts.Overrides,
+		Accept:               opts.Accept,
+		ClusterSet:           opts.ClusterSet,
+		ClusterSetBindings:   opts.ClusterSetBindings,
+		Claims:               opts.Claims,
+		Addons:               opts.Addons,
+		Verify:               opts.Verify,
+		Baseline:             opts.Baseline,
+		WaitBaseline:         opts.WaitBaseline,
+		PreProvision:         opts.PreProvision,
+		LeaseDurationSeconds: opts.LeaseDurationSeconds,
+	}
+	if opts.SpokeConfig != nil {
+		spec.Server = opts.SpokeConfig.Host
+		spec.CAData = opts.SpokeConfig.CAData
+		spec.CertData = opts.SpokeConfig.CertData
+		spec.KeyData = opts.SpokeConfig.KeyData
+		spec.BearerToken = opts.SpokeConfig.BearerToken
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16], nil
+}
+
+// readClusterFiles reads the yaml files of dir ordered by name, the cluster name defaults to the file name,
+// also for the files which can't be parsed. A cluster defined by more than one file is invalid in all of them.
+func readClusterFiles(dir string) ([]clusterFile, error) {
+	data, err := common.ReadManifestDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []clusterFile
+	byCluster := map[string][]int{}
+	for _, name := range names {
+		f := clusterFile{file: name, hash: fmt.Sprintf("%x", sha256.Sum256(data[name]))[:16]}
+		if f.err = yaml.Unmarshal(data[name], &f.cluster); f.err != nil {
+			// the file which can't be parsed still holds the cluster named after it
+			f.cluster = inventoryCluster{}
+		}
+		if len(f.cluster.Name) == 0 {
+			f.cluster.Name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		if f.err == nil && len(f.cluster.CredentialSecret) == 0 {
+			f.err = fmt.Errorf("credentialSecret is required")
+		}
+		byCluster[f.cluster.Name] = append(byCluster[f.cluster.Name], len(files))
+		files = append(files, f)
+	}
+	for cluster, indexes := range byCluster {
+		if len(indexes) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			files[i].err = fmt.Errorf("cluster %s is defined by more than one file", cluster)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadClusterFiles(t *testing.T) {
+	// want maps the file name to the cluster it holds, and whether the file is invalid
+	type want struct {
+		cluster string
+		invalid bool
+	}
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  map[string]want
+	}{
+		{name: "empty directory", files: map[string]string{}, want: map[string]want{}},
+		{
+			name: "cluster named after the file",
+			files: map[string]string{
+				"a.yaml":    "credentialSecret: default/a\n",
+				"b.yml":     "name: c\ncredentialSecret: default/b\n",
+				"notes.txt": "not a cluster file",
+			},
+			want: map[string]want{"a.yaml": {cluster: "a"}, "b.yml": {cluster: "c"}},
+		},
+		{
+			name:  "missing credential secret",
+			files: map[string]string{"a.yaml": "labels:\n  env: prod\n"},
+			want:  map[string]want{"a.yaml": {cluster: "a", invalid: true}},
+		},
+		{
+			name:  "malformed file keeps the cluster of its name",
+			files: map[string]string{"a.yaml": "credentialSecret: [default/a\n"},
+			want:  map[string]want{"a.yaml": {cluster: "a", invalid: true}},
+		},
+		{
+			name:  "wrong type keeps the cluster of its name",
+			files: map[string]string{"a.yaml": "name: [b]\ncredentialSecret: default/a\n"},
+			want:  map[string]want{"a.yaml": {cluster: "a", invalid: true}},
+		},
+		{
+			name: "duplicated cluster is invalid in every file",
+			files: map[string]string{
+				"a.yaml": "credentialSecret: default/a\n",
+				"b.yaml": "name: a\ncredentialSecret: default/b\n",
+				"c.yaml": "credentialSecret: default/c\n",
+			},
+			want: map[string]want{"a.yaml": {cluster: "a", invalid: true}, "b.yaml": {cluster: "a", invalid: true}, "c.yaml": {cluster: "c"}},
+		},
+		{
+			name: "same file stem with different extensions",
+			files: map[string]string{
+				"a.yaml": "credentialSecret: default/a\n",
+				"a.yml":  "credentialSecret: default/a\n",
+			},
+			want: map[string]want{"a.yaml": {cluster: "a", invalid: true}, "a.yml": {cluster: "a", invalid: true}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range c.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			files, err := readClusterFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]want{}
+			for i, f := range files {
+				if i != 0 && files[i-1].file >= f.file {
+					t.Errorf("files aren't ordered by name: %s, %s", files[i-1].file, f.file)
+				}
+				if len(f.hash) != 16 {
+					t.Errorf("unexpected hash %q of %s", f.hash, f.file)
+				}
+				got[f.file] = want{cluster: f.cluster.Name, invalid: f.err != nil}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	defer func(d time.Duration) { watchDebounce = d }(watchDebounce)
+	watchDebounce = 200 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "clusters")
+	for _, d := range []string{dir, filepath.Join(parent, "worktree")} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := watchDir(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(5 * watchDebounce):
+			t.Fatalf("expect a change after %s", what)
+		}
+	}
+
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte("credentialSecret: default/a\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectChange("writing files")
+	select {
+	case <-changes:
+		t.Fatal("expect a burst of changes to be notified once")
+	case <-time.After(2 * watchDebounce):
+	}
+
+	// a sibling of dir isn't a change of it
+	if err = os.WriteFile(filepath.Join(parent, "worktree", "c.yaml"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("expect no change of a sibling directory")
+	case <-time.After(2 * watchDebounce):
+	}
+
+	// dir is swapped as a whole
+	if err = os.Rename(dir, filepath.Join(parent, "old")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join(parent, "worktree"), dir); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("swapping the directory")
+	if err = os.WriteFile(filepath.Join(dir, "d.yaml"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("writing a file of the swapped directory")
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog/v2"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+)
+
+const (
+	// bootstrapSecretInline renders the bootstrap hub kubeconfig with a token minted on hub-cluster
+	bootstrapSecretInline = "inline"
+	// bootstrapSecretPlaceholder renders the bootstrap hub kubeconfig as a SealedSecret placeholder
+	bootstrapSecretPlaceholder = "placeholder"
+)
+
+// runRender writes the manifests of registration to stdout or a directory without contacting the spoke-cluster,
+// so that they can be applied by GitOps tools
+func runRender(args []string) int {
+	var opts options
+	var outputDir string
+	var includeHub bool
+	var bootstrapSecret string
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	opts.addFlags(fs)
+	fs.StringVar(&outputDir, "output-dir", "", "directory to write the manifests to, write to stdout if empty")
+	fs.BoolVar(&includeHub, "include-hub", false, "also render the bootstrap RBAC and ManagedCluster of hub cluster")
+	fs.StringVar(&bootstrapSecret, "bootstrap-secret", bootstrapSecretPlaceholder, "how to render the bootstrap hub kubeconfig secret, inline or placeholder")
+	_ = fs.Parse(args)
+	opts.decodeParameters()
+
+	if bootstrapSecret != bootstrapSecretInline && bootstrapSecret != bootstrapSecretPlaceholder {
+		klog.InfoS("Unknown bootstrap secret mode", "mode", bootstrapSecret)
+		return 1
+	}
+
+	accept, err := opts.acceptOptions()
+	if err != nil {
+		klog.InfoS("Invalid metadata of managed cluster", "err", err)
+		return 1
+	}
+	clusterSetBindings, err := opts.clusterSetBindings()
+	if err != nil {
+		klog.InfoS("Invalid cluster set of managed cluster", "err", err)
+		return 1
+	}
+	claims, err := opts.parseClaims()
+	if err != nil {
+		klog.InfoS("Invalid claims of managed cluster", "err", err)
+		return 1
+	}
+	addons, err := opts.parseAddons()
+	if err != nil {
+		klog.InfoS("Invalid addons of managed cluster", "err", err)
+		return 1
+	}
+	if len(opts.clusterSet) != 0 {
+		accept.Labels[ocmclusterv1beta2.ClusterSetLabel] = opts.clusterSet
+	}
+
+	ctx := context.Background()
+
+	// hub-cluster is only contacted to mint the token or to read the resource overrides and baseline
+	hubCluster := &hub.Cluster{}
+	if bootstrapSecret == bootstrapSecretInline || len(opts.resourceConfigMap) != 0 || len(opts.baselineConfigMap) != 0 {
+		hubCluster, err = hub.NewHubCluster(nil)
+		if err != nil {
+			klog.InfoS("Fail to create client connect to hub cluster", "err", err)
+			return 1
+		}
+	}
+	overrides, err := loadOverrides(ctx, hubCluster, opts.resourceDir, opts.resourceConfigMap)
+	if err != nil {
+		klog.InfoS("Fail to load resource overrides", "err", err)
+		return 1
+	}
+	hubCluster.Overrides = overrides
+
+	spokeConfig, err := opts.spokeConfig()
+	if err != nil || spokeConfig == nil {
+		klog.InfoS("Fail to get spoke-cluster kubeconfig", "err", err)
+		return 1
+	}
+
+	hubKubeConfig := &clientcmdapiv1.Config{}
+	if bootstrapSecret == bootstrapSecretInline {
+		hubKubeConfig, err = hubCluster.GenerateHubClusterKubeConfig(ctx, opts.hubIP)
+		if err != nil {
+			klog.InfoS("Fail to generate the token for spoke-cluster", "err", err)
+			return 1
+		}
+	}
+
+	spokeCluster := &spoke.Cluster{
+		Name: opts.clusterName,
+		Args: common.Args{Overrides: overrides},
+		HubInfo: spoke.HubInfo{
+			KubeConfig: hubKubeConfig,
+			APIServer:  spokeConfig.Host,
+		},
+	}
+	spokeObjects, err := spokeCluster.RenderSpokeClusterEnv()
+	if err != nil {
+		klog.InfoS("Fail to render the env for spoke-cluster", "err", err)
+		return 1
+	}
+	// the generated claims need the spoke-cluster, only the given ones are rendered
+	claimObjects, err := spokeCluster.RenderClusterClaims(claims)
+	if err != nil {
+		klog.InfoS("Fail to render the cluster claims", "err", err)
+		return 1
+	}
+	spokeObjects = append(spokeObjects, claimObjects...)
+	if bootstrapSecret == bootstrapSecretPlaceholder {
+		for i, obj := range spokeObjects {
+			if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Secret" {
+				spokeObjects[i] = spoke.SealedSecretPlaceholder(obj)
+			}
+		}
+	}
+
+	manifests := map[string][]*unstructured.Unstructured{"spoke": spokeObjects}
+	if includeHub {
+		hubObjects, err := hubCluster.RenderBootstrapResources()
+		if err != nil {
+			klog.InfoS("Fail to render the bootstrap resources of hub-cluster", "err", err)
+			return 1
+		}
+		mc, err := hubCluster.RenderManagedCluster(opts.clusterName, accept)
+		if err != nil {
+			klog.InfoS("Fail to render the managed cluster", "err", err)
+			return 1
+		}
+		if len(opts.clusterSet) != 0 {
+			clusterSetObjects, err := hubCluster.RenderManagedClusterSet(opts.clusterSet, clusterSetBindings)
+			if err != nil {
+				klog.InfoS("Fail to render the managed cluster set", "err", err)
+				return 1
+			}
+			hubObjects = append(hubObjects, clusterSetObjects...)
+		}
+		addonObjects, err := hubCluster.RenderManagedClusterAddons(opts.clusterName, addons)
+		if err != nil {
+			klog.InfoS("Fail to render the managed cluster addons", "err", err)
+			return 1
+		}
+		baseline, err := loadBaseline(ctx, hubCluster, opts.baselineDir, opts.baselineConfigMap)
+		if err != nil {
+			klog.InfoS("Fail to load baseline manifests", "err", err)
+			return 1
+		}
+		baselineWorks, err := hubCluster.RenderBaselineWorks(opts.clusterName, baseline)
+		if err != nil {
+			klog.InfoS("Fail to render the baseline ManifestWorks", "err", err)
+			return 1
+		}
+		hubObjects = append(hubObjects, mc)
+		hubObjects = append(hubObjects, addonObjects...)
+		manifests["hub"] = append(hubObjects, baselineWorks...)
+	}
+
+	if err = writeManifests(outputDir, manifests); err != nil {
+		klog.InfoS("Fail to write manifests", "err", err)
+		return 1
+	}
+	return 0
+}
+
+// writeManifests writes the manifests of each cluster to <dir>/<cluster>/, one file per object.
+// If dir is empty, all the manifests are written to stdout.
+func writeManifests(dir string, manifests map[string][]*unstructured.Unstructured) error {
+	for _, cluster := range []string{"hub", "spoke"} {
+		objects, ok := manifests[cluster]
+		if !ok {
+			continue
+		}
+		if len(dir) == 0 {
+			data, err := common.EncodeObjects(objects)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(os.Stdout, "# %s cluster\n---\n%s---\n", cluster, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		clusterDir := filepath.Join(dir, cluster)
+		if err := os.MkdirAll(clusterDir, 0755); err != nil {
+			return err
+		}
+		for i, obj := range objects {
+			data, err := common.EncodeObjects([]*unstructured.Unstructured{obj})
+			if err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%02d-%s-%s.yaml", i, strings.ToLower(obj.GetKind()), strings.ReplaceAll(obj.GetName(), ":", "-"))
+			if err = os.WriteFile(filepath.Join(clusterDir, name), data, 0600); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/register"
+)
+
+// reportOptions are where the report of a registration is written to, besides the log
+type reportOptions struct {
+	// terminationLog is the termination message path of the container, skipped if the file doesn't exist
+	terminationLog string
+	// configMap is <namespace>/<name> of a ConfigMap on hub-cluster
+	configMap string
+	// secret is <namespace>/<name> of a Secret on hub-cluster, usually the source of the spoke-cluster credential
+	secret string
+}
+
+// writeReport writes the report to every destination, a failed destination doesn't stop the others
+func writeReport(ctx context.Context, hubCluster *hub.Cluster, opts reportOptions, report *register.Report) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		klog.InfoS("Fail to encode the report", "err", err)
+		return
+	}
+	klog.V(common.LogDebug).InfoS("registration report", "report", string(data))
+
+	if len(opts.terminationLog) != 0 {
+		if err = writeTerminationLog(opts.terminationLog, report); err != nil {
+			klog.V(common.LogDebug).InfoS("Skip writing the termination log", "path", opts.terminationLog, "err", err)
+		}
+	}
+	if len(opts.configMap) != 0 {
+		namespace, name, err := splitNamespacedName(opts.configMap)
+		if err == nil {
+			err = hubCluster.SaveReportToConfigMap(ctx, namespace, name, report.Cluster, data)
+		}
+		if err != nil {
+			klog.InfoS("Fail to write the report to configmap", "configmap", opts.configMap, "err", err)
+		}
+	}
+	if len(opts.secret) != 0 {
+		namespace, name, err := splitNamespacedName(opts.secret)
+		if err == nil {
+			err = hubCluster.SaveReportToSecret(ctx, namespace, name, data)
+		}
+		if err != nil {
+			klog.InfoS("Fail to write the report to secret", "secret", opts.secret, "err", err)
+		}
+	}
+}
+
+// writeTerminationLog writes the report to the termination message file created by kubelet
+func writeTerminationLog(path string, report *register.Report) error {
+	data, err := report.TerminationMessage()
+	if err != nil {
+		return err
+	}
+	// the file is created by kubelet, it isn't created out of a pod
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -2,40 +2,48 @@ package common
 
 import (
 	"context"
-	"embed"
 
-	"github.com/ghodss/yaml"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/oam-dev/cluster-register/pkg/tracing"
 )
 
 const (
 	OpenClusterManagementNamespace = "open-cluster-management"
 	BootstrapSAName                = "cluster-bootstrap"
 	HubClusterName                 = "hub"
+	// DryRunToken replaces the bootstrap token in dry-run, in which no token is minted
+	DryRunToken = "<dry-run>"
 )
 
 type Args struct {
 	KubeConfig *rest.Config
 	Schema     *runtime.Scheme
 	Client     client.Client
+	Overrides  *Overrides
+	DryRun     bool
+	Tracker    *Tracker
 }
 
 func (a *Args) SetConfig(kconfig *rest.Config) error {
 	if kconfig != nil {
-		a.KubeConfig = kconfig
+		// every request sent by the clients of the config is traced
+		a.KubeConfig = tracing.WrapConfig(kconfig)
 		return nil
 	}
 	kubeConfig, err := config.GetConfig()
 	if err != nil {
 		return err
 	}
-	a.KubeConfig = kubeConfig
+	a.KubeConfig = tracing.WrapConfig(kubeConfig)
 	return nil
 }
 
@@ -59,20 +67,90 @@ func (a *Args) SetClient() error {
 	return nil
 }
 
-func ApplyK8sResource(ctx context.Context, f embed.FS, k8sClient client.Client, files []string) error {
-	for _, file := range files {
-		data, err := f.ReadFile(file)
+// EnableDryRun makes every following write request of the client a server-side dry-run
+func (a *Args) EnableDryRun() {
+	a.DryRun = true
+	a.Client = client.NewDryRunClient(a.Client)
+}
+
+// DryRunOptions returns the dryRun field of the requests sent by clientset
+func (a *Args) DryRunOptions() []string {
+	if a.DryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// ApplyObjects creates or updates objects in order, the changes are recorded by the Tracker if any
+func (a *Args) ApplyObjects(ctx context.Context, objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		previous, err := createOrUpdateResource(ctx, a.Client, obj)
+		if err != nil && a.DryRun && isMissingDependency(err) {
+			// the namespace or CRD of the object was only created in dry-run
+			klog.InfoS("Skip dry-run of resource whose dependency doesn't exist yet", "object", klog.KObj(obj), "kind", obj.GetKind(), "err", err)
+			continue
+		}
+		if err != nil {
+			klog.InfoS("Fail to create resource", "object", klog.KObj(obj), "apiVersion", obj.GetAPIVersion(), "kind", obj.GetKind())
+			return err
+		}
+		if !a.DryRun && a.Tracker != nil {
+			a.Tracker.Record(a.KubeConfig.Host, a.Client, obj, previous)
+		}
+	}
+	return nil
+}
+
+// CreateObjects creates the objects which don't exist in order, the existing ones are left untouched.
+// The created objects are recorded by the Tracker if any.
+func (a *Args) CreateObjects(ctx context.Context, objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		existing := new(unstructured.Unstructured)
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		err := a.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+		if err == nil {
+			continue
+		}
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+		klog.InfoS("create resource", "object", klog.KObj(obj), "kind", obj.GetKind())
+		err = a.Client.Create(ctx, obj)
+		if err != nil && a.DryRun && isMissingDependency(err) {
+			klog.InfoS("Skip dry-run of resource whose dependency doesn't exist yet", "object", klog.KObj(obj), "kind", obj.GetKind(), "err", err)
+			continue
+		}
 		if err != nil {
-			klog.Error(err, "Fail to read embed file ", "name:", file)
 			return err
 		}
-		k8sObject := new(unstructured.Unstructured)
-		err = yaml.Unmarshal(data, k8sObject)
+		if !a.DryRun && a.Tracker != nil {
+			a.Tracker.Record(a.KubeConfig.Host, a.Client, obj, nil)
+		}
+	}
+	return nil
+}
+
+func isMissingDependency(err error) bool {
+	return kerrors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
+
+func ApplyK8sResource(ctx context.Context, resources Resources, k8sClient client.Client, files []string) error {
+	for _, file := range files {
+		k8sObjects, err := resources.Objects(file)
 		if err != nil {
-			klog.Error(err, "Fail to unmarshal file", "name", file)
+			klog.Error(err, "Fail to load resource file ", "name:", file)
 			return err
 		}
-		err = CreateOrUpdateResource(ctx, k8sClient, k8sObject)
+		if err = ApplyK8sObjects(ctx, k8sClient, k8sObjects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ApplyK8sObjects(ctx context.Context, k8sClient client.Client, k8sObjects []*unstructured.Unstructured) error {
+	for _, k8sObject := range k8sObjects {
+		err := CreateOrUpdateResource(ctx, k8sClient, k8sObject)
 		if err != nil {
 			klog.InfoS("Fail to create resource", "object", klog.KObj(k8sObject), "apiVersion", k8sObject.GetAPIVersion(), "kind", k8sObject.GetKind())
 			return err
@@ -82,12 +160,23 @@ func ApplyK8sResource(ctx context.Context, f embed.FS, k8sClient client.Client,
 }
 
 func CreateOrUpdateResource(ctx context.Context, k8sClient client.Client, resource *unstructured.Unstructured) error {
+	_, err := createOrUpdateResource(ctx, k8sClient, resource)
+	return err
+}
+
+// createOrUpdateResource returns the object before updating, or nil if it is created
+func createOrUpdateResource(ctx context.Context, k8sClient client.Client, resource *unstructured.Unstructured) (*unstructured.Unstructured, error) {
 	objKey := client.ObjectKey{Name: resource.GetName(), Namespace: resource.GetNamespace()}
-	if err := k8sClient.Get(ctx, objKey, resource); err != nil {
+	existing := new(unstructured.Unstructured)
+	existing.SetGroupVersionKind(resource.GroupVersionKind())
+	if err := k8sClient.Get(ctx, objKey, existing); err != nil {
 		if kerrors.IsNotFound(err) {
-			return k8sClient.Create(ctx, resource)
+			klog.V(LogDebug).InfoS("create resource", "object", klog.KObj(resource), "kind", resource.GetKind())
+			return nil, k8sClient.Create(ctx, resource)
 		}
-		return err
+		return nil, err
 	}
-	return k8sClient.Update(ctx, resource)
+	resource.SetResourceVersion(existing.GetResourceVersion())
+	klog.V(LogDebug).InfoS("update resource", "object", klog.KObj(resource), "kind", resource.GetKind())
+	return existing, k8sClient.Update(ctx, resource)
 }
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"github.com/pmezard/go-difflib/difflib"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DiffObject returns the unified diff between the live object and the rendered one.
+// The rendered object is sent to the apiserver as a server-side dry-run first, so that
+// defaulted fields don't show up in the diff. Secret data are redacted.
+func DiffObject(ctx context.Context, k8sClient client.Client, rendered *unstructured.Unstructured) (string, error) {
+	live := new(unstructured.Unstructured)
+	live.SetGroupVersionKind(rendered.GroupVersionKind())
+	err := k8sClient.Get(ctx, client.ObjectKeyFromObject(rendered), live)
+	if err != nil && !kerrors.IsNotFound(err) && !isMissingDependency(err) {
+		return "", err
+	}
+	exist := err == nil
+
+	merged := rendered.DeepCopy()
+	dryRunClient := client.NewDryRunClient(k8sClient)
+	if exist {
+		merged.SetResourceVersion(live.GetResourceVersion())
+		err = dryRunClient.Update(ctx, merged)
+	} else {
+		err = dryRunClient.Create(ctx, merged)
+	}
+	if err != nil {
+		klog.V(LogDebug).InfoS("Fail to dry-run resource, diff with the rendered one", "object", klog.KObj(rendered), "kind", rendered.GetKind(), "err", err)
+		merged = rendered.DeepCopy()
+	}
+
+	var from, to string
+	if exist {
+		if from, err = normalizeForDiff(live); err != nil {
+			return "", err
+		}
+	}
+	if to, err = normalizeForDiff(merged); err != nil {
+		return "", err
+	}
+
+	name := path.Join(rendered.GetKind(), rendered.GetNamespace(), rendered.GetName())
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: path.Join("live", name),
+		ToFile:   path.Join("rendered", name),
+		Context:  3,
+	})
+}
+
+func normalizeForDiff(obj *unstructured.Unstructured) (string, error) {
+	obj = obj.DeepCopy()
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+	if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			data, found, _ := unstructured.NestedMap(obj.Object, field)
+			if !found {
+				continue
+			}
+			for key, value := range data {
+				sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+				data[key] = fmt.Sprintf("<redacted sha256:%x>", sum[:8])
+			}
+			_ = unstructured.SetNestedMap(obj.Object, data, field)
+		}
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,295 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// patchPrefix marks an override entry as a strategic merge patch
+	patchPrefix = "patch."
+)
+
+// Overrides replaces or patches the manifests embedded in this binary.
+//
+// Entries are keyed by "<component>.<file name>", e.g. "spoke.operator.yaml"
+// replaces pkg/spoke/resource/operator.yaml and "hub.bootstrap_sa.yaml"
+// replaces pkg/hub/resource/bootstrap_sa.yaml. An entry for a component whose
+// file name is not embedded is applied as an additional manifest. Entries
+// named "patch.*.yaml" hold kustomize-style strategic merge patches, which are
+// applied to every object with the same apiVersion, kind, name and namespace.
+type Overrides struct {
+	Files   map[string][]byte
+	Patches []*unstructured.Unstructured
+}
+
+// NewOverrides builds Overrides from a set of named manifests
+func NewOverrides(files map[string][]byte) (*Overrides, error) {
+	o := &Overrides{Files: map[string][]byte{}}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasPrefix(name, patchPrefix) {
+			o.Files[name] = files[name]
+			continue
+		}
+		patches, err := DecodeObjects(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode patch %s: %w", name, err)
+		}
+		o.Patches = append(o.Patches, patches...)
+	}
+	return o, nil
+}
+
+// LoadOverridesFromDir reads the yaml files of a directory as Overrides
+func LoadOverridesFromDir(dir string) (*Overrides, error) {
+	files, err := ReadManifestDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewOverrides(files)
+}
+
+// LoadOverridesFromConfigMap reads the data of a ConfigMap as Overrides
+func LoadOverridesFromConfigMap(ctx context.Context, k8sClient client.Client, namespace, name string) (*Overrides, error) {
+	files, err := ReadManifestConfigMap(ctx, k8sClient, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewOverrides(files)
+}
+
+// ReadManifestDir returns the content of every yaml file in dir, keyed by file name
+func ReadManifestDir(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isYAMLFile(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = data
+	}
+	return files, nil
+}
+
+// ReadManifestConfigMap returns the yaml entries of a ConfigMap, keyed by data key
+func ReadManifestConfigMap(ctx context.Context, k8sClient client.Client, namespace, name string) (map[string][]byte, error) {
+	cm := new(corev1.ConfigMap)
+	if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm); err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for key, value := range cm.Data {
+		if isYAMLFile(key) {
+			files[key] = []byte(value)
+		}
+	}
+	return files, nil
+}
+
+func isYAMLFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Patch applies every matching patch to obj in place
+func (o *Overrides) Patch(obj *unstructured.Unstructured) error {
+	if o == nil {
+		return nil
+	}
+	for _, p := range o.Patches {
+		if !patchMatches(p, obj) {
+			continue
+		}
+		original, err := json.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		patch, err := json.Marshal(p.Object)
+		if err != nil {
+			return err
+		}
+		var patched []byte
+		if dataStruct, err := Scheme.New(obj.GroupVersionKind()); err == nil {
+			patched, err = strategicpatch.StrategicMergePatch(original, patch, dataStruct)
+			if err != nil {
+				return err
+			}
+		} else {
+			// types unknown to the scheme, e.g. CRDs of other projects, fall back to json merge patch
+			patched, err = jsonpatch.MergePatch(original, patch)
+			if err != nil {
+				return err
+			}
+		}
+		patchedObj := map[string]interface{}{}
+		if err = json.Unmarshal(patched, &patchedObj); err != nil {
+			return err
+		}
+		obj.Object = patchedObj
+		klog.V(LogDebug).InfoS("patch resource", "object", klog.KObj(obj), "kind", obj.GetKind())
+	}
+	return nil
+}
+
+func patchMatches(patch, obj *unstructured.Unstructured) bool {
+	if patch.GetAPIVersion() != obj.GetAPIVersion() || patch.GetKind() != obj.GetKind() || patch.GetName() != obj.GetName() {
+		return false
+	}
+	return patch.GetNamespace() == "" || patch.GetNamespace() == obj.GetNamespace()
+}
+
+// Resources is the set of manifests embedded in one component, e.g. "hub" or "spoke",
+// together with the user provided Overrides
+type Resources struct {
+	FS        embed.FS
+	Component string
+	Overrides *Overrides
+}
+
+func (r Resources) key(file string) string {
+	return r.Component + "." + path.Base(file)
+}
+
+// ReadFile returns the overridden content of file, or the embedded one if it is not overridden
+func (r Resources) ReadFile(file string) ([]byte, error) {
+	if r.Overrides != nil {
+		if data, ok := r.Overrides.Files[r.key(file)]; ok {
+			klog.V(LogDebug).InfoS("use overridden resource", "name", file)
+			return data, nil
+		}
+	}
+	return r.FS.ReadFile(file)
+}
+
+// ExtraFiles returns the override files of the component which don't replace an embedded file
+func (r Resources) ExtraFiles(dir string) []string {
+	if r.Overrides == nil {
+		return nil
+	}
+	var files []string
+	for key := range r.Overrides.Files {
+		if !strings.HasPrefix(key, r.Component+".") {
+			continue
+		}
+		file := path.Join(dir, strings.TrimPrefix(key, r.Component+"."))
+		if _, err := fs.Stat(r.FS, file); err == nil {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Objects decodes every object of file and applies the matching patches
+func (r Resources) Objects(file string) ([]*unstructured.Unstructured, error) {
+	data, err := r.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return r.Decode(data)
+}
+
+// Decode decodes the objects of a rendered manifest and applies the matching patches
+func (r Resources) Decode(data []byte) ([]*unstructured.Unstructured, error) {
+	objects, err := DecodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if err = r.Overrides.Patch(obj); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// DecodeObjects decodes a multi-document yaml, empty documents are skipped
+func DecodeObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj := new(unstructured.Unstructured)
+		if err = utilyaml.Unmarshal(doc, &obj.Object); err != nil {
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// ToUnstructured converts a typed object registered in Scheme to unstructured
+func ToUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, Scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, nil
+}
+
+// EncodeObjects encodes objects as a multi-document yaml
+func EncodeObjects(objects []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
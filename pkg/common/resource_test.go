@@ -0,0 +1,44 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestDecodeObjects(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		names   []string
+		wantErr bool
+	}{
+		{name: "empty", data: "", names: nil},
+		{name: "single", data: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: a\n", names: []string{"a"}},
+		{
+			name:  "multiple documents in order",
+			data:  "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: b\n",
+			names: []string{"a", "b"},
+		},
+		{
+			name:  "empty and comment documents are skipped",
+			data:  "---\n# comment only\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: a\n---\n",
+			names: []string{"a"},
+		},
+		{name: "malformed", data: "apiVersion: v1\nkind: [Namespace\n", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objects, err := DecodeObjects([]byte(c.data))
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expect error %v, got %v", c.wantErr, err)
+			}
+			if len(objects) != len(c.names) {
+				t.Fatalf("expect %d objects, got %d", len(c.names), len(objects))
+			}
+			for i, obj := range objects {
+				if obj.GetName() != c.names[i] {
+					t.Errorf("expect object %d to be %s, got %s", i, c.names[i], obj.GetName())
+				}
+			}
+		})
+	}
+}
@@ -4,7 +4,10 @@ import (
 	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	ocmclusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
 	ocmapiv1 "open-cluster-management.io/api/operator/v1"
 	ocmworkv1 "open-cluster-management.io/api/work/v1"
 )
@@ -17,6 +20,9 @@ func init() {
 	_ = clientgoscheme.AddToScheme(Scheme)
 	_ = crdv1.AddToScheme(Scheme)
 	_ = ocmapiv1.Install(Scheme)
+	_ = addonv1alpha1.Install(Scheme)
 	_ = ocmclusterv1.Install(Scheme)
+	_ = ocmclusterv1alpha1.Install(Scheme)
+	_ = ocmclusterv1beta2.Install(Scheme)
 	_ = ocmworkv1.Install(Scheme)
 }
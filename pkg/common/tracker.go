@@ -0,0 +1,173 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Action is the change made to an object
+type Action string
+
+const (
+	ActionCreated Action = "created"
+	ActionUpdated Action = "updated"
+)
+
+// TrackedObject is an object changed by this run
+type TrackedObject struct {
+	// Cluster is the apiserver address of the cluster the object belongs to
+	Cluster string `json:"cluster"`
+	Action  Action `json:"action"`
+	Kind    string `json:"kind"`
+	// Name is <namespace>/<name> for namespaced objects
+	Name string `json:"name"`
+	// RolledBack is whether the change was rolled back
+	RolledBack bool `json:"rolledBack,omitempty"`
+
+	client   client.Client
+	object   *unstructured.Unstructured
+	previous *unstructured.Unstructured
+}
+
+// Tracker records the objects created or updated by this run, so that they can be rolled back
+type Tracker struct {
+	mu      sync.Mutex
+	objects []*TrackedObject
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Record records the object applied by k8sClient, previous is nil if the object was created.
+// An object is only recorded by its first change, which is the one to roll back to.
+func (t *Tracker) Record(cluster string, k8sClient client.Client, object, previous *unstructured.Unstructured) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked := &TrackedObject{
+		Cluster:  cluster,
+		Action:   ActionCreated,
+		Kind:     object.GetKind(),
+		Name:     klog.KObj(object).String(),
+		client:   k8sClient,
+		object:   object.DeepCopy(),
+		previous: previous,
+	}
+	if previous != nil {
+		tracked.Action = ActionUpdated
+	}
+	for _, o := range t.objects {
+		if o.Cluster == tracked.Cluster && o.Kind == tracked.Kind && o.Name == tracked.Name &&
+			o.object.GetAPIVersion() == object.GetAPIVersion() {
+			return
+		}
+	}
+	t.objects = append(t.objects, tracked)
+}
+
+// RecordTyped records a typed object, see Record
+func (t *Tracker) RecordTyped(cluster string, k8sClient client.Client, object, previous client.Object) {
+	if t == nil {
+		return
+	}
+	obj, err := ToUnstructured(object)
+	if err != nil {
+		klog.InfoS("Fail to track object", "object", klog.KObj(object), "err", err)
+		return
+	}
+	var prev *unstructured.Unstructured
+	if previous != nil {
+		if prev, err = ToUnstructured(previous); err != nil {
+			klog.InfoS("Fail to track object", "object", klog.KObj(object), "err", err)
+			return
+		}
+	}
+	t.Record(cluster, k8sClient, obj, prev)
+}
+
+// Objects returns the tracked objects in the order of changing
+func (t *Tracker) Objects() []TrackedObject {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make([]TrackedObject, 0, len(t.objects))
+	for _, o := range t.objects {
+		res = append(res, *o)
+	}
+	return res
+}
+
+// Rollback deletes the created objects and restores the updated ones, in the reverse order of changing
+func (t *Tracker) Rollback(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for i := len(t.objects) - 1; i >= 0; i-- {
+		o := t.objects[i]
+		if o.RolledBack {
+			continue
+		}
+		var err error
+		if o.Action == ActionCreated {
+			err = deleteAndWait(ctx, o.client, o.object)
+		} else {
+			err = restore(ctx, o.client, o.previous)
+		}
+		if err != nil {
+			klog.InfoS("Fail to roll back object", "cluster", o.Cluster, "action", o.Action, "kind", o.Kind, "object", o.Name, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		o.RolledBack = true
+		klog.InfoS("roll back object", "cluster", o.Cluster, "action", o.Action, "kind", o.Kind, "object", o.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// deleteAndWait deletes the object and waits for its finalizers, e.g. the klusterlet's, which are removed
+// by controllers that may be rolled back next
+func deleteAndWait(ctx context.Context, k8sClient client.Client, obj *unstructured.Unstructured) error {
+	obj = obj.DeepCopy()
+	if err := k8sClient.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	err := wait.PollImmediate(time.Second, 2*time.Minute, func() (bool, error) {
+		err := k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		klog.InfoS("Object isn't deleted yet", "object", klog.KObj(obj), "kind", obj.GetKind(), "err", err)
+	}
+	return nil
+}
+
+func restore(ctx context.Context, k8sClient client.Client, previous *unstructured.Unstructured) error {
+	latest := new(unstructured.Unstructured)
+	latest.SetGroupVersionKind(previous.GroupVersionKind())
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(previous), latest); err != nil {
+		return err
+	}
+	obj := previous.DeepCopy()
+	obj.SetResourceVersion(latest.GetResourceVersion())
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	return k8sClient.Update(ctx, obj)
+}
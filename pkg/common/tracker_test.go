@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestTrackerRollback(t *testing.T) {
+	ctx := context.Background()
+	configMap := func(name, value string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Data:       map[string]string{"key": value},
+		}
+	}
+	// calls are the rollback requests in the order they are sent
+	var calls []string
+	k8sClient := fake.NewClientBuilder().WithScheme(Scheme).WithObjects(configMap("updated", "old")).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				calls = append(calls, "delete "+obj.GetName())
+				return c.Delete(ctx, obj, opts...)
+			},
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				calls = append(calls, "update "+obj.GetName())
+				return c.Update(ctx, obj, opts...)
+			},
+		}).Build()
+
+	tracker := NewTracker()
+	created := configMap("created", "new")
+	if err := k8sClient.Create(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	tracker.RecordTyped("hub", k8sClient, created, nil)
+
+	previous := new(corev1.ConfigMap)
+	if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "updated"}, previous); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"first", "second"} {
+		latest := new(corev1.ConfigMap)
+		if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(previous), latest); err != nil {
+			t.Fatal(err)
+		}
+		before := latest.DeepCopy()
+		latest.Data["key"] = value
+		if err := k8sClient.Update(ctx, latest); err != nil {
+			t.Fatal(err)
+		}
+		// only the first change is recorded, which is the one to roll back to
+		tracker.RecordTyped("hub", k8sClient, latest, before)
+	}
+	calls = nil
+
+	objects := tracker.Objects()
+	if len(objects) != 2 || objects[0].Action != ActionCreated || objects[1].Action != ActionUpdated {
+		t.Fatalf("expect a created and an updated object, got %+v", objects)
+	}
+
+	if err := tracker.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"update updated", "delete created"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("expect rollback calls %v, got %v", want, calls)
+	}
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(created), new(corev1.ConfigMap)); !kerrors.IsNotFound(err) {
+		t.Errorf("expect the created object to be deleted, got %v", err)
+	}
+	restored := new(corev1.ConfigMap)
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(previous), restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Data["key"] != "old" {
+		t.Errorf("expect the updated object to be restored to old, got %s", restored.Data["key"])
+	}
+	for _, o := range tracker.Objects() {
+		if !o.RolledBack {
+			t.Errorf("expect %s %s to be rolled back", o.Kind, o.Name)
+		}
+	}
+
+	// a rolled back object isn't rolled back again
+	calls = nil
+	if err := tracker.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expect no rollback calls, got %v", calls)
+	}
+}
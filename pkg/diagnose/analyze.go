@@ -0,0 +1,204 @@
+package diagnose
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+const (
+	SeverityError   = "Error"
+	SeverityWarning = "Warning"
+)
+
+// Finding is a problem found by an analyzer
+type Finding struct {
+	Analyzer string `json:"analyzer"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// analyzer explains a common failure from the collected state
+type analyzer struct {
+	name    string
+	analyze func(s *state) []Finding
+}
+
+var analyzers = []analyzer{
+	{name: "managed-cluster", analyze: analyzeManagedCluster},
+	{name: "csr", analyze: analyzeCSR},
+	{name: "bootstrap-token", analyze: analyzeBootstrapToken},
+	{name: "hub-endpoint", analyze: analyzeHubEndpoint},
+	{name: "hub-reachability", analyze: analyzeAgentLogs},
+}
+
+func analyze(s *state) []Finding {
+	var findings []Finding
+	for _, a := range analyzers {
+		for _, f := range a.analyze(s) {
+			f.Analyzer = a.name
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+func analyzeManagedCluster(s *state) []Finding {
+	mc := s.managedCluster
+	if mc == nil {
+		return []Finding{{Severity: SeverityWarning,
+			Message: "managed cluster doesn't exist, the registration agent hasn't sent its register request",
+			Hint:    "check the klusterlet and the logs of the registration agent on the spoke cluster"}}
+	}
+	if !mc.Spec.HubAcceptsClient {
+		return []Finding{{Severity: SeverityError, Message: "managed cluster isn't accepted by the hub cluster",
+			Hint: "run the registration again, it accepts the managed cluster"}}
+	}
+	cond := meta.FindStatusCondition(mc.Status.Conditions, ocmclusterv1.ManagedClusterConditionAvailable)
+	switch {
+	case cond == nil:
+		return []Finding{{Severity: SeverityWarning, Message: "managed cluster has no Available condition yet"}}
+	case cond.Status != metav1.ConditionTrue:
+		return []Finding{{Severity: SeverityError,
+			Message: strings.TrimSpace(fmt.Sprintf("managed cluster isn't available: %s %s", cond.Reason, cond.Message)),
+			Hint:    "the registration agent doesn't renew its lease, check whether it can reach the hub cluster"}}
+	}
+	return nil
+}
+
+func analyzeCSR(s *state) []Finding {
+	var findings []Finding
+	pending := 0
+	for _, csr := range s.csrs {
+		for _, cond := range csr.Status.Conditions {
+			if cond.Type == certificatesv1.CertificateDenied {
+				findings = append(findings, Finding{Severity: SeverityError,
+					Message: strings.TrimSpace(fmt.Sprintf("csr %s is denied: %s %s", csr.Name, cond.Reason, cond.Message)),
+					Hint:    "delete the denied csr, the registration agent creates a new one to be approved"})
+			}
+		}
+		if len(csr.Status.Conditions) == 0 {
+			pending++
+		}
+	}
+	if pending != 0 {
+		findings = append(findings, Finding{Severity: SeverityWarning,
+			Message: fmt.Sprintf("%d csr of the cluster are neither approved nor denied", pending),
+			Hint:    "run the registration again, it approves the csr"})
+	}
+	return findings
+}
+
+func analyzeBootstrapToken(s *state) []Finding {
+	if !s.spokeCollected {
+		return nil
+	}
+	if s.bootstrapKubeConfig == nil {
+		return []Finding{{Severity: SeverityError, Message: "bootstrap hub kubeconfig doesn't exist on the spoke cluster",
+			Hint: "the klusterlet isn't deployed, run the registration again"}}
+	}
+	for _, auth := range s.bootstrapKubeConfig.AuthInfos {
+		if hub.TokenValid(auth.AuthInfo.Token, 0) {
+			continue
+		}
+		if s.hubKubeConfigExists {
+			// the agent bootstrapped already, the expired token is only a problem if it has to bootstrap again
+			return []Finding{{Severity: SeverityWarning, Message: "bootstrap token has expired",
+				Hint: "the agent can't bootstrap again with it, e.g. after its hub kubeconfig is deleted"}}
+		}
+		return []Finding{{Severity: SeverityError, Message: "bootstrap token has expired before the agent bootstrapped",
+			Hint: "run the registration again with --restart to issue a new token"}}
+	}
+	return nil
+}
+
+func analyzeHubEndpoint(s *state) []Finding {
+	if s.expectedHub == nil {
+		return nil
+	}
+	var findings []Finding
+	names := make([]string, 0, len(s.joinedHubs))
+	for name := range s.joinedHubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		joined := s.joinedHubs[name]
+		if len(joined.CAData) != 0 && !bytes.Equal(bytes.TrimSpace(joined.CAData), bytes.TrimSpace(s.expectedHub.CAData)) {
+			findings = append(findings, Finding{Severity: SeverityError,
+				Message: fmt.Sprintf("certificate authority of %s differs from the one of the hub cluster", name),
+				Hint:    "the spoke cluster is joined to another hub cluster, or the hub cluster rotated its CA, register with --takeover"})
+		}
+		if joined.Server != s.expectedHub.Server {
+			findings = append(findings, Finding{Severity: SeverityWarning,
+				Message: fmt.Sprintf("server %s of %s differs from %s of the hub cluster", joined.Server, name, s.expectedHub.Server),
+				Hint:    "make sure the server is the address of this hub cluster reachable from the spoke cluster"})
+		}
+	}
+	return findings
+}
+
+// logPatterns are the log messages of the agents and the failures they indicate
+var logPatterns = []struct {
+	pattern  string
+	severity string
+	message  string
+	hint     string
+}{
+	{"x509: certificate signed by unknown authority", SeverityError, "agent doesn't trust the certificate of the hub cluster",
+		"the certificate authority in the bootstrap kubeconfig mismatches the hub cluster"},
+	{"no such host", SeverityError, "agent can't resolve the address of the hub cluster",
+		"set --hub-api-server to an address resolvable from the spoke cluster"},
+	{"connection refused", SeverityError, "hub cluster is unreachable from the spoke cluster",
+		"check the address of the hub cluster and the firewall between the clusters"},
+	{"i/o timeout", SeverityError, "hub cluster is unreachable from the spoke cluster",
+		"check the address of the hub cluster and the firewall between the clusters"},
+	{"Unauthorized", SeverityError, "agent is unauthorized by the hub cluster",
+		"the bootstrap token has expired or is revoked, run the registration again with --restart"},
+}
+
+// analyzeAgentLogs looks for the known failures in the logs of the agents, once per failure
+func analyzeAgentLogs(s *state) []Finding {
+	files := make([]string, 0, len(s.logs))
+	for file := range s.logs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var findings []Finding
+	for _, p := range logPatterns {
+		for _, file := range files {
+			line := lastLineContaining(s.logs[file], p.pattern)
+			if len(line) == 0 {
+				continue
+			}
+			findings = append(findings, Finding{Severity: p.severity,
+				Message: fmt.Sprintf("%s, %s: %s", p.message, file, line), Hint: p.hint})
+			break
+		}
+	}
+	return findings
+}
+
+func lastLineContaining(log, pattern string) string {
+	lines := strings.Split(log, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], pattern) {
+			line := strings.TrimSpace(lines[i])
+			if len(line) > 300 {
+				line = line[:300] + "..."
+			}
+			return line
+		}
+	}
+	return ""
+}
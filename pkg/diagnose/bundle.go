@@ -0,0 +1,81 @@
+package diagnose
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bundle is the support bundle of a cluster
+type Bundle struct {
+	Cluster string
+	// Files are keyed by their path in the tarball
+	Files map[string][]byte
+	// Errors are the data which fail to be collected
+	Errors []string
+	// Findings are the explanations of the analyzers
+	Findings []Finding
+}
+
+// Summary is the human readable findings and errors, which is written to summary.txt of the tarball
+func (b *Bundle) Summary() string {
+	sb := new(strings.Builder)
+	fmt.Fprintf(sb, "Diagnosis of cluster %s\n\n", b.Cluster)
+	if len(b.Findings) == 0 {
+		sb.WriteString("No known problem is found.\n")
+	}
+	for _, f := range b.Findings {
+		fmt.Fprintf(sb, "[%s] %s: %s\n", f.Severity, f.Analyzer, f.Message)
+		if len(f.Hint) != 0 {
+			fmt.Fprintf(sb, "  hint: %s\n", f.Hint)
+		}
+	}
+	if len(b.Errors) != 0 {
+		sb.WriteString("\nFail to collect:\n")
+		for _, e := range b.Errors {
+			fmt.Fprintf(sb, "- %s\n", e)
+		}
+	}
+	return sb.String()
+}
+
+// WriteTarball writes the files and the summary as a gzipped tarball, under the <cluster>-diagnose directory
+func (b *Bundle) WriteTarball(w io.Writer) error {
+	files := map[string][]byte{"summary.txt": []byte(b.Summary())}
+	for name, data := range b.Files {
+		files[name] = data
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		data := files[name]
+		header := &tar.Header{
+			Name:    path.Join(b.Cluster+"-diagnose", name),
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
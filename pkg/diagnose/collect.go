@@ -0,0 +1,263 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	ocmapiv1 "open-cluster-management.io/api/operator/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+)
+
+// jwtPattern matches the bearer tokens, which are redacted from the logs
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+
+// Collector gathers the state of the registration of a cluster from the hub and spoke cluster
+type Collector struct {
+	ClusterName string
+	Hub         *hub.Cluster
+	// Spoke is nil if the spoke-cluster isn't accessible, only the hub-cluster is diagnosed
+	Spoke *spoke.Cluster
+	// HubAPIServer is the address of hub-cluster the spoke-cluster is expected to connect, the one of
+	// cluster-info if empty
+	HubAPIServer string
+	// LogLines is the number of lines of each container log
+	LogLines int64
+}
+
+// state is the collected objects the analyzers work on
+type state struct {
+	managedCluster *ocmclusterv1.ManagedCluster
+	csrs           []certificatesv1.CertificateSigningRequest
+	// expectedHub is the hub-cluster from cluster-info
+	expectedHub *spoke.HubEndpoint
+	// spokeCollected is set if the spoke-cluster is collected
+	spokeCollected bool
+	// bootstrapKubeConfig is nil if the bootstrap secret doesn't exist
+	bootstrapKubeConfig *clientcmdapiv1.Config
+	// hubKubeConfigExists is set if the agent got its hub kubeconfig
+	hubKubeConfigExists bool
+	joinedHubs          map[string]spoke.HubEndpoint
+	// logs are keyed by the path of the log file
+	logs map[string]string
+}
+
+// Collect gathers the support bundle, the data which fails to be collected are recorded in the bundle
+func (c *Collector) Collect(ctx context.Context) *Bundle {
+	b := &Bundle{Cluster: c.ClusterName, Files: map[string][]byte{}}
+	s := &state{logs: map[string]string{}}
+	c.collectHub(ctx, b, s)
+	if c.Spoke != nil {
+		c.collectSpoke(ctx, b, s)
+	}
+	b.Findings = analyze(s)
+	return b
+}
+
+func (c *Collector) collectHub(ctx context.Context, b *Bundle, s *state) {
+	mc, err := c.Hub.GetManagedCluster(ctx, c.ClusterName)
+	switch {
+	case err == nil:
+		s.managedCluster = mc
+		b.addObject("hub/managedcluster.yaml", mc)
+	case kerrors.IsNotFound(err):
+		b.addFile("hub/managedcluster.yaml", []byte(fmt.Sprintf("# managed cluster %s doesn't exist\n", c.ClusterName)))
+	default:
+		b.addError("get managed cluster", err)
+	}
+
+	if s.csrs, err = c.Hub.ListSpokeClusterCSRs(ctx, c.ClusterName); err != nil {
+		b.addError("list csr", err)
+	} else {
+		b.addObject("hub/csrs.yaml", s.csrs)
+	}
+
+	if info, err := c.Hub.GetHubClusterInfo(ctx, c.HubAPIServer); err != nil {
+		b.addError("get cluster-info of hub cluster", err)
+	} else {
+		s.expectedHub = &spoke.HubEndpoint{Server: info.Clusters[0].Cluster.Server, CAData: info.Clusters[0].Cluster.CertificateAuthorityData}
+	}
+
+	// the events of ManagedCluster are in the default namespace, the ones of its agents are in the cluster namespace
+	events := new(corev1.EventList)
+	if err = c.Hub.Client.List(ctx, events, client.InNamespace(metav1.NamespaceDefault),
+		client.MatchingFields{"involvedObject.kind": "ManagedCluster", "involvedObject.name": c.ClusterName}); err != nil {
+		b.addError("list events of managed cluster", err)
+	}
+	clusterEvents := new(corev1.EventList)
+	if err = c.Hub.Client.List(ctx, clusterEvents, client.InNamespace(c.ClusterName)); err != nil {
+		b.addError("list events of cluster namespace", err)
+	}
+	b.addObject("hub/events.yaml", append(append(events.Items, clusterEvents.Items...), c.registrationPodEvents(ctx, b)...))
+}
+
+// registrationPodEvents lists the events of the cluster emitted to the pod running the registration before the
+// ManagedCluster exists. The namespace of the pod is unknown, so they are matched by the source and the cluster
+// name prefixed to their message in all namespaces.
+func (c *Collector) registrationPodEvents(ctx context.Context, b *Bundle) []corev1.Event {
+	podEvents := new(corev1.EventList)
+	if err := c.Hub.Client.List(ctx, podEvents,
+		client.MatchingFields{"involvedObject.kind": "Pod", "source": hub.EventComponent}); err != nil {
+		b.addError("list events of registration pod", err)
+		return nil
+	}
+	var events []corev1.Event
+	for _, event := range podEvents.Items {
+		if strings.HasPrefix(event.Message, "["+c.ClusterName+"] ") {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (c *Collector) collectSpoke(ctx context.Context, b *Bundle, s *state) {
+	s.spokeCollected = true
+	k8sClient := c.Spoke.Args.Client
+
+	klusterlets := new(ocmapiv1.KlusterletList)
+	if err := k8sClient.List(ctx, klusterlets); err != nil {
+		b.addError("list klusterlets", err)
+	} else {
+		b.addObject("spoke/klusterlets.yaml", klusterlets.Items)
+	}
+
+	var secrets []redactedSecret
+	for _, name := range []string{spoke.BootstrapHubKubeConfigSecret, spoke.HubKubeConfigSecret} {
+		secret := new(corev1.Secret)
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: spoke.AgentNamespace, Name: name}, secret)
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			b.addError("get secret "+name, err)
+			continue
+		}
+		secrets = append(secrets, redact(secret))
+		if name == spoke.HubKubeConfigSecret {
+			s.hubKubeConfigExists = true
+		}
+	}
+	b.addObject("spoke/secrets.yaml", secrets)
+
+	if kubeConfig, err := c.Spoke.GetBootstrapHubKubeConfig(ctx); err == nil {
+		s.bootstrapKubeConfig = kubeConfig
+	} else if !kerrors.IsNotFound(err) {
+		b.addError("get bootstrap kubeconfig", err)
+	}
+	joined, err := c.Spoke.GetJoinedHubs(ctx)
+	if err != nil {
+		b.addError("get joined hub clusters", err)
+	}
+	s.joinedHubs = joined
+
+	clientset, err := kubernetes.NewForConfig(c.Spoke.Args.KubeConfig)
+	if err != nil {
+		b.addError("create clientset of spoke cluster", err)
+		return
+	}
+	var events []corev1.Event
+	for _, namespace := range []string{spoke.OperatorNamespace, spoke.AgentNamespace} {
+		pods := new(corev1.PodList)
+		if err = k8sClient.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+			b.addError("list pods of "+namespace, err)
+			continue
+		}
+		b.addObject(path.Join("spoke", namespace, "pods.yaml"), pods.Items)
+		for _, pod := range pods.Items {
+			c.collectLogs(ctx, b, s, clientset, &pod)
+		}
+
+		nsEvents := new(corev1.EventList)
+		if err = k8sClient.List(ctx, nsEvents, client.InNamespace(namespace)); err != nil {
+			b.addError("list events of "+namespace, err)
+			continue
+		}
+		events = append(events, nsEvents.Items...)
+	}
+	b.addObject("spoke/events.yaml", events)
+}
+
+// collectLogs gets the logs of the containers of pod, and the logs of their previous instance if restarted
+func (c *Collector) collectLogs(ctx context.Context, b *Bundle, s *state, clientset kubernetes.Interface, pod *corev1.Pod) {
+	for _, status := range pod.Status.ContainerStatuses {
+		for _, previous := range []bool{false, true} {
+			if previous && status.RestartCount == 0 {
+				continue
+			}
+			name := status.Name + ".log"
+			if previous {
+				name = status.Name + ".previous.log"
+			}
+			file := path.Join("spoke", pod.Namespace, "logs", pod.Name, name)
+			data, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container: status.Name,
+				Previous:  previous,
+				TailLines: &c.LogLines,
+			}).DoRaw(ctx)
+			if err != nil {
+				b.addError("get logs of "+file, err)
+				continue
+			}
+			data = jwtPattern.ReplaceAll(data, []byte("<redacted token>"))
+			s.logs[file] = string(data)
+			b.addFile(file, data)
+		}
+	}
+}
+
+// redactedSecret is a secret without its data, only the size of every key is kept
+type redactedSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Type              corev1.SecretType `json:"type,omitempty"`
+	Data              map[string]string `json:"data,omitempty"`
+}
+
+func redact(secret *corev1.Secret) redactedSecret {
+	r := redactedSecret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: *secret.ObjectMeta.DeepCopy(),
+		Type:       secret.Type,
+		Data:       map[string]string{},
+	}
+	r.ManagedFields = nil
+	// the last applied configuration has the data of the secret
+	delete(r.Annotations, corev1.LastAppliedConfigAnnotation)
+	for k, v := range secret.Data {
+		r.Data[k] = fmt.Sprintf("<redacted, %d bytes>", len(v))
+	}
+	return r
+}
+
+// addObject adds the yaml of obj to the bundle
+func (b *Bundle) addObject(file string, obj interface{}) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		b.addError("encode "+file, err)
+		return
+	}
+	b.addFile(file, data)
+}
+
+func (b *Bundle) addFile(file string, data []byte) {
+	b.Files[file] = data
+}
+
+func (b *Bundle) addError(what string, err error) {
+	klog.InfoS("Fail to collect", "what", what, "err", err)
+	b.Errors = append(b.Errors, fmt.Sprintf("%s: %v", what, err))
+}
@@ -0,0 +1,304 @@
+package gateway
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"embed"
+	"fmt"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	// Namespace is the namespace of the cluster secrets on hub-cluster and the service account on spoke-cluster
+	Namespace = "vela-system"
+	// CredentialTypeLabel is the label of cluster secrets recognized by cluster-gateway
+	CredentialTypeLabel = "cluster.core.oam.dev/cluster-credential-type"
+	// CredentialTypeX509 authenticates to spoke-cluster with a client certificate
+	CredentialTypeX509 = "X509Certificate"
+	// CredentialTypeServiceAccountToken authenticates to spoke-cluster with a service account token
+	CredentialTypeServiceAccountToken = "ServiceAccountToken"
+
+	// userName is the service account, and the user of the client certificate, of cluster-gateway on spoke-cluster
+	userName        = "cluster-gateway"
+	tokenSecretName = "cluster-gateway-token"
+	// clusterRoleName is the embedded ClusterRole of cluster-gateway, which only impersonates the identity of requests
+	clusterRoleName = "cluster-gateway"
+)
+
+//go:embed resource
+var f embed.FS
+
+// Credential is what cluster-gateway authenticates to spoke-cluster with
+type Credential struct {
+	Type     string
+	Token    string
+	CertData []byte
+	KeyData  []byte
+}
+
+// Cluster is the spoke-cluster registered to cluster-gateway
+type Cluster struct {
+	Name string
+	Args common.Args
+	// ClusterRole is bound to cluster-gateway on spoke-cluster, the embedded least-privilege ClusterRole if empty
+	ClusterRole string
+}
+
+// NewSpokeCluster creates the client of the spoke-cluster
+func NewSpokeCluster(name string, config *rest.Config) (*Cluster, error) {
+	args := common.Args{
+		Schema: common.Scheme,
+	}
+	if err := args.SetConfig(config); err != nil {
+		return nil, err
+	}
+	if err := args.SetClient(); err != nil {
+		return nil, err
+	}
+	return &Cluster{Name: name, Args: args}, nil
+}
+
+func (c *Cluster) resources() common.Resources {
+	return common.Resources{FS: f, Component: "gateway", Overrides: c.Args.Overrides}
+}
+
+// RenderServiceAccount renders the service account of cluster-gateway on spoke-cluster and its permissions,
+// together with the additional user provided resources. The token secret is only rendered for ServiceAccountToken,
+// and the user of the client certificate is bound to the same ClusterRole for X509Certificate.
+func (c *Cluster) RenderServiceAccount(credentialType string) ([]*unstructured.Unstructured, error) {
+	resources := c.resources()
+	files := []string{
+		"resource/namespace.yaml",
+		"resource/service_account.yaml",
+	}
+	if credentialType == CredentialTypeServiceAccountToken {
+		files = append(files, "resource/token_secret.yaml")
+	}
+	if len(c.ClusterRole) == 0 || c.ClusterRole == clusterRoleName {
+		files = append(files, "resource/cluster_role.yaml")
+	}
+	files = append(files, resources.ExtraFiles("resource")...)
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		fileObjects, err := resources.Objects(file)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, fileObjects...)
+	}
+
+	data, err := resources.ReadFile("resource/cluster_role_binding.yaml")
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := common.DecodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		if err = c.bindClusterRole(binding, credentialType); err != nil {
+			return nil, err
+		}
+		if err = resources.Overrides.Patch(binding); err != nil {
+			return nil, err
+		}
+	}
+	return append(objects, bindings...), nil
+}
+
+// bindClusterRole sets the ClusterRole of the binding, and adds the user of the client certificate for X509Certificate
+func (c *Cluster) bindClusterRole(binding *unstructured.Unstructured, credentialType string) error {
+	if binding.GetKind() != "ClusterRoleBinding" {
+		return nil
+	}
+	if len(c.ClusterRole) != 0 {
+		if err := unstructured.SetNestedField(binding.Object, c.ClusterRole, "roleRef", "name"); err != nil {
+			return err
+		}
+	}
+	if credentialType != CredentialTypeX509 {
+		return nil
+	}
+	subjects, _, err := unstructured.NestedSlice(binding.Object, "subjects")
+	if err != nil {
+		return err
+	}
+	subjects = append(subjects, map[string]interface{}{
+		"apiGroup": rbacv1.GroupName,
+		"kind":     rbacv1.UserKind,
+		"name":     userName,
+	})
+	return unstructured.SetNestedSlice(binding.Object, subjects, "subjects")
+}
+
+// IssueCredential creates the service account of cluster-gateway on spoke-cluster,
+// and mints a long-lived token or a client certificate for it
+func (c *Cluster) IssueCredential(ctx context.Context, credentialType string) (*Credential, error) {
+	objects, err := c.RenderServiceAccount(credentialType)
+	if err != nil {
+		return nil, err
+	}
+	// the token secret is only created, updating it would wipe the token minted for it
+	var applied, created []*unstructured.Unstructured
+	for _, obj := range objects {
+		if obj.GetKind() == "Secret" && obj.GetName() == tokenSecretName {
+			created = append(created, obj)
+		} else {
+			applied = append(applied, obj)
+		}
+	}
+	if err = c.Args.ApplyObjects(ctx, applied); err != nil {
+		return nil, err
+	}
+	if err = c.Args.CreateObjects(ctx, created); err != nil {
+		return nil, err
+	}
+
+	cred := &Credential{Type: credentialType}
+	// never mint a credential in dry-run
+	if c.Args.DryRun {
+		if credentialType == CredentialTypeX509 {
+			cred.CertData, cred.KeyData = []byte(common.DryRunToken), []byte(common.DryRunToken)
+		} else {
+			cred.Token = common.DryRunToken
+		}
+		return cred, nil
+	}
+
+	switch credentialType {
+	case CredentialTypeServiceAccountToken:
+		cred.Token, err = c.waitForToken(ctx)
+	case CredentialTypeX509:
+		cred.CertData, cred.KeyData, err = c.issueClientCert(ctx)
+	default:
+		err = fmt.Errorf("unknown credential type %s", credentialType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (c *Cluster) waitForToken(ctx context.Context) (string, error) {
+	var token string
+	secret := new(corev1.Secret)
+	secretKey := client.ObjectKey{Namespace: Namespace, Name: tokenSecretName}
+	err := wait.PollImmediate(2*time.Second, 30*time.Second, func() (bool, error) {
+		if err := c.Args.Client.Get(ctx, secretKey, secret); err != nil {
+			klog.V(common.LogDebug).InfoS("Fail to get token secret", "object", klog.KRef(secretKey.Namespace, secretKey.Name), "err", err)
+			return false, nil
+		}
+		token = string(secret.Data[corev1.ServiceAccountTokenKey])
+		return len(token) != 0, nil
+	})
+	return token, err
+}
+
+// issueClientCert signs a client certificate of the cluster-gateway user by the kube-apiserver-client signer
+func (c *Cluster) issueClientCert(ctx context.Context) ([]byte, []byte, error) {
+	keyData, err := keyutil.MakeEllipticPrivateKeyPEM()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(keyData)
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := cert.MakeCSR(key, &pkix.Name{CommonName: userName}, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(c.Args.KubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	csrs := clientset.CertificatesV1().CertificateSigningRequests()
+	csr, err := csrs.Create(ctx, &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: userName + "-"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageClientAuth},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	// the certificate is only issued once, the csr is of no use afterwards
+	defer func() {
+		if err := csrs.Delete(ctx, csr.Name, metav1.DeleteOptions{}); client.IgnoreNotFound(err) != nil {
+			klog.InfoS("Fail to delete csr", "name", csr.Name, "err", err)
+		}
+	}()
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Status:         corev1.ConditionTrue,
+		Type:           certificatesv1.CertificateApproved,
+		Reason:         "ClusterRegisterApprove",
+		Message:        "This CSR was approved by cluster-register for cluster-gateway.",
+		LastUpdateTime: metav1.Now(),
+	})
+	if _, err = csrs.UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+		return nil, nil, err
+	}
+
+	var certData []byte
+	err = wait.PollImmediate(2*time.Second, time.Minute, func() (bool, error) {
+		current, err := csrs.Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		certData = current.Status.Certificate
+		return len(certData) != 0, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificate of csr %s isn't issued: %w", csr.Name, err)
+	}
+	return certData, keyData, nil
+}
+
+// RenderClusterSecret renders the secret of the cluster on hub-cluster in the format of cluster-gateway
+func RenderClusterSecret(name, endpoint string, caData []byte, cred *Credential, labels, annotations map[string]string) (*unstructured.Unstructured, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   Namespace,
+			Labels:      map[string]string{},
+			Annotations: annotations,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"endpoint": []byte(endpoint),
+		},
+	}
+	for k, v := range labels {
+		secret.Labels[k] = v
+	}
+	secret.Labels[CredentialTypeLabel] = cred.Type
+	if len(caData) != 0 {
+		secret.Data["ca.crt"] = caData
+	}
+	switch cred.Type {
+	case CredentialTypeServiceAccountToken:
+		secret.Data["token"] = []byte(cred.Token)
+	case CredentialTypeX509:
+		secret.Data[corev1.TLSCertKey] = cred.CertData
+		secret.Data[corev1.TLSPrivateKeyKey] = cred.KeyData
+	}
+	return common.ToUnstructured(secret)
+}
@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+func TestRenderServiceAccount(t *testing.T) {
+	cases := []struct {
+		credentialType string
+		wantSecret     bool
+	}{
+		{credentialType: CredentialTypeServiceAccountToken, wantSecret: true},
+		{credentialType: CredentialTypeX509, wantSecret: false},
+	}
+	for _, c := range cases {
+		t.Run(c.credentialType, func(t *testing.T) {
+			objects, err := (&Cluster{Name: "a"}).RenderServiceAccount(c.credentialType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasSecret := false
+			for _, obj := range objects {
+				if obj.GetKind() == "Secret" && obj.GetName() == tokenSecretName {
+					hasSecret = true
+				}
+			}
+			if hasSecret != c.wantSecret {
+				t.Errorf("expect token secret %v, got %v", c.wantSecret, hasSecret)
+			}
+		})
+	}
+}
+
+func TestIssueCredentialKeepsToken(t *testing.T) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: Namespace, Name: tokenSecretName,
+			Annotations: map[string]string{corev1.ServiceAccountNameKey: userName}},
+		Type: corev1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte("token")},
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(common.Scheme).WithObjects(secret).Build()
+	c := &Cluster{Name: "a", Args: common.Args{Client: k8sClient, KubeConfig: &rest.Config{Host: "spoke"}, DryRun: true}}
+	if _, err := c.IssueCredential(ctx, CredentialTypeServiceAccountToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[corev1.ServiceAccountTokenKey]) != "token" {
+		t.Errorf("expect the token to be kept, got %v", secret.Data)
+	}
+}
+
+func TestRenderClusterSecret(t *testing.T) {
+	cases := []struct {
+		name     string
+		caData   []byte
+		cred     *Credential
+		wantData map[string]string
+	}{
+		{
+			name:     "service account token",
+			caData:   []byte("ca"),
+			cred:     &Credential{Type: CredentialTypeServiceAccountToken, Token: "token"},
+			wantData: map[string]string{"endpoint": "https://1.2.3.4:6443", "ca.crt": "ca", "token": "token"},
+		},
+		{
+			name:     "client certificate",
+			caData:   []byte("ca"),
+			cred:     &Credential{Type: CredentialTypeX509, CertData: []byte("cert"), KeyData: []byte("key")},
+			wantData: map[string]string{"endpoint": "https://1.2.3.4:6443", "ca.crt": "ca", corev1.TLSCertKey: "cert", corev1.TLSPrivateKeyKey: "key"},
+		},
+		{
+			name:     "without ca",
+			cred:     &Credential{Type: CredentialTypeServiceAccountToken, Token: "token"},
+			wantData: map[string]string{"endpoint": "https://1.2.3.4:6443", "token": "token"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			labels := map[string]string{"env": "prod", CredentialTypeLabel: "overridden"}
+			annotations := map[string]string{"description": "a"}
+			obj, err := RenderClusterSecret("a", "https://1.2.3.4:6443", c.caData, c.cred, labels, annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			secret := new(corev1.Secret)
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, secret); err != nil {
+				t.Fatal(err)
+			}
+			if secret.Name != "a" || secret.Namespace != Namespace || secret.Type != corev1.SecretTypeOpaque {
+				t.Errorf("unexpected secret %s/%s of type %s", secret.Namespace, secret.Name, secret.Type)
+			}
+			if want := map[string]string{"env": "prod", CredentialTypeLabel: c.cred.Type}; !reflect.DeepEqual(secret.Labels, want) {
+				t.Errorf("expect labels %v, got %v", want, secret.Labels)
+			}
+			if !reflect.DeepEqual(secret.Annotations, annotations) {
+				t.Errorf("expect annotations %v, got %v", annotations, secret.Annotations)
+			}
+			if labels[CredentialTypeLabel] != "overridden" {
+				t.Error("expect the labels of caller to be unchanged")
+			}
+			data := map[string]string{}
+			for k, v := range secret.Data {
+				data[k] = string(v)
+			}
+			if !reflect.DeepEqual(data, c.wantData) {
+				t.Errorf("expect data %v, got %v", c.wantData, data)
+			}
+		})
+	}
+}
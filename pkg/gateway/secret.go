@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EndpointTypeLabel is the label of cluster secrets telling how cluster-gateway reaches the spoke-cluster
+	EndpointTypeLabel = "cluster.core.oam.dev/cluster-endpoint-type"
+	// EndpointTypeClusterProxy reaches the spoke-cluster through the OCM cluster-proxy add-on
+	EndpointTypeClusterProxy = "ClusterProxy"
+	// ClusterProxyAddon is the OCM add-on EndpointTypeClusterProxy relies on
+	ClusterProxyAddon = "cluster-proxy"
+	// CredentialTypeDynamic uses the credential issued for the OCM ManagedCluster of the same name
+	CredentialTypeDynamic = "Dynamic"
+	// ManagedClusterAnnotation records the OCM ManagedCluster a cluster secret is imported as
+	ManagedClusterAnnotation = "cluster-register.oam.dev/managed-cluster"
+
+	// velaLabelPrefix is the prefix of the labels maintained by KubeVela on cluster secrets
+	velaLabelPrefix = "cluster.core.oam.dev/"
+)
+
+// ListClusterSecrets lists the cluster secrets of cluster-gateway on hub-cluster, ordered by name
+func ListClusterSecrets(ctx context.Context, k8sClient client.Client) ([]corev1.Secret, error) {
+	secrets := new(corev1.SecretList)
+	if err := k8sClient.List(ctx, secrets, client.InNamespace(Namespace), client.HasLabels{CredentialTypeLabel}); err != nil {
+		return nil, err
+	}
+	sort.Slice(secrets.Items, func(i, j int) bool {
+		return secrets.Items[i].Name < secrets.Items[j].Name
+	})
+	return secrets.Items, nil
+}
+
+// KubeConfigFromSecret builds the kubeconfig of the spoke-cluster from a cluster secret with a static credential.
+// A cluster secret without ca.crt is refused, unless insecureSkipTLSVerify skips verifying the server certificate.
+func KubeConfigFromSecret(secret *corev1.Secret, insecureSkipTLSVerify bool) (*clientcmdapiv1.Config, error) {
+	endpoint := string(secret.Data["endpoint"])
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("endpoint of cluster secret %s is empty", secret.Name)
+	}
+	cluster := clientcmdapiv1.Cluster{Server: endpoint, CertificateAuthorityData: secret.Data["ca.crt"]}
+	if len(cluster.CertificateAuthorityData) == 0 {
+		if !insecureSkipTLSVerify {
+			return nil, fmt.Errorf("ca.crt of cluster secret %s is empty, the server certificate can't be verified", secret.Name)
+		}
+		klog.InfoS("Insecure: skip verifying the server certificate of cluster secret without ca.crt", "object", klog.KObj(secret), "endpoint", endpoint)
+		cluster.InsecureSkipTLSVerify = true
+	}
+
+	var authInfo clientcmdapiv1.AuthInfo
+	switch credentialType := secret.Labels[CredentialTypeLabel]; credentialType {
+	case CredentialTypeServiceAccountToken:
+		authInfo.Token = string(secret.Data["token"])
+	case CredentialTypeX509:
+		authInfo.ClientCertificateData = secret.Data[corev1.TLSCertKey]
+		authInfo.ClientKeyData = secret.Data[corev1.TLSPrivateKeyKey]
+	default:
+		return nil, fmt.Errorf("credential type %s of cluster secret %s isn't supported", credentialType, secret.Name)
+	}
+
+	return &clientcmdapiv1.Config{
+		Clusters:       []clientcmdapiv1.NamedCluster{{Name: secret.Name, Cluster: cluster}},
+		AuthInfos:      []clientcmdapiv1.NamedAuthInfo{{Name: secret.Name, AuthInfo: authInfo}},
+		Contexts:       []clientcmdapiv1.NamedContext{{Name: secret.Name, Context: clientcmdapiv1.Context{Cluster: secret.Name, AuthInfo: secret.Name}}},
+		CurrentContext: secret.Name,
+	}, nil
+}
+
+// ClusterLabels returns the user labels of a cluster secret, without the ones maintained by KubeVela
+func ClusterLabels(secret *corev1.Secret) map[string]string {
+	labels := map[string]string{}
+	for k, v := range secret.Labels {
+		if !strings.HasPrefix(k, velaLabelPrefix) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// MarkImported annotates the cluster secret with the ManagedCluster it is imported as.
+// If switchToOCM, cluster-gateway reaches the cluster through OCM afterwards instead of the static credential.
+func MarkImported(ctx context.Context, k8sClient client.Client, secret *corev1.Secret, managedCluster string, switchToOCM bool) error {
+	updated := secret.DeepCopy()
+	metav1.SetMetaDataAnnotation(&updated.ObjectMeta, ManagedClusterAnnotation, managedCluster)
+	if switchToOCM {
+		metav1.SetMetaDataLabel(&updated.ObjectMeta, CredentialTypeLabel, CredentialTypeDynamic)
+		metav1.SetMetaDataLabel(&updated.ObjectMeta, EndpointTypeLabel, EndpointTypeClusterProxy)
+	}
+	klog.InfoS("mark cluster secret imported", "object", klog.KObj(secret), "managedCluster", managedCluster, "switchToOCM", switchToOCM)
+	return k8sClient.Patch(ctx, updated, client.MergeFrom(secret))
+}
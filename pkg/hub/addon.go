@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+// Addon is an OCM add-on enabled on the managed cluster
+type Addon struct {
+	Name string
+	// InstallNamespace is the namespace of the add-on agent on spoke-cluster, the default of the add-on is used if empty
+	InstallNamespace string
+}
+
+// AddonStatus is the health of an add-on of the managed cluster
+type AddonStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ParseAddons parses add-ons in the form of name1=installNamespace1,name2
+func ParseAddons(s string) ([]Addon, error) {
+	var addons []Addon
+	for _, item := range splitList(s) {
+		addon, err := ParseAddon(item)
+		if err != nil {
+			return nil, err
+		}
+		addons = append(addons, addon)
+	}
+	return addons, nil
+}
+
+// ParseAddon parses a single add-on in the form of name[=installNamespace]
+func ParseAddon(s string) (Addon, error) {
+	name, namespace, _ := strings.Cut(strings.TrimSpace(s), "=")
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return Addon{}, fmt.Errorf("invalid addon name %s: %s", name, strings.Join(errs, ", "))
+	}
+	if len(namespace) != 0 {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) != 0 {
+			return Addon{}, fmt.Errorf("invalid install namespace of addon %s: %s", name, strings.Join(errs, ", "))
+		}
+	}
+	return Addon{Name: name, InstallNamespace: namespace}, nil
+}
+
+// RenderManagedClusterAddons renders the ManagedClusterAddOns in the namespace of the managed cluster
+func (c *Cluster) RenderManagedClusterAddons(clusterName string, addons []Addon) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for _, addon := range addons {
+		obj, err := common.ToUnstructured(&addonv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{Name: addon.Name, Namespace: clusterName},
+			Spec:       addonv1alpha1.ManagedClusterAddOnSpec{InstallNamespace: addon.InstallNamespace},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = c.resources().Overrides.Patch(obj); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// EnableAddons creates the ManagedClusterAddOns which don't exist, the existing ones are left untouched
+func (c *Cluster) EnableAddons(ctx context.Context, clusterName string, addons []Addon) error {
+	objects, err := c.RenderManagedClusterAddons(clusterName, addons)
+	if err != nil {
+		return err
+	}
+	return c.CreateObjects(ctx, objects)
+}
+
+// WaitForAddonsAvailable waits for the add-ons to be available until timeout, and returns their health.
+// An add-on which isn't available in time is reported instead of failing the wait.
+func (c *Cluster) WaitForAddonsAvailable(ctx context.Context, clusterName string, addons []Addon, timeout time.Duration) ([]AddonStatus, error) {
+	startTime := time.Now()
+	var statuses []AddonStatus
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		klog.V(common.LogDebug).InfoS("Waiting for addons available", "waitTime", time.Since(startTime))
+		var err error
+		statuses, err = c.GetAddonStatus(ctx, clusterName, addons)
+		if err != nil {
+			return false, nil
+		}
+		for _, status := range statuses {
+			if !status.Available {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return nil, err
+	}
+	if statuses == nil {
+		return c.GetAddonStatus(ctx, clusterName, addons)
+	}
+	return statuses, nil
+}
+
+// GetAddonStatus returns the health of the add-ons of the managed cluster by the Available condition
+func (c *Cluster) GetAddonStatus(ctx context.Context, clusterName string, addons []Addon) ([]AddonStatus, error) {
+	var statuses []AddonStatus
+	for _, addon := range addons {
+		mca := new(addonv1alpha1.ManagedClusterAddOn)
+		if err := c.Client.Get(ctx, client.ObjectKey{Namespace: clusterName, Name: addon.Name}, mca); err != nil {
+			return nil, err
+		}
+		status := AddonStatus{Name: addon.Name}
+		if cond := meta.FindStatusCondition(mca.Status.Conditions, addonv1alpha1.ManagedClusterAddOnConditionAvailable); cond != nil {
+			status.Available = cond.Status == metav1.ConditionTrue
+			status.Message = cond.Message
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -12,18 +12,23 @@ import (
 	authv1 "k8s.io/api/authentication/v1"
 	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/metrics"
 )
 
 const (
@@ -35,6 +40,8 @@ var f embed.FS
 
 type Cluster struct {
 	common.Args
+	// Recorder emits the events of registrations, no event is emitted if it is nil
+	Recorder *EventRecorder
 }
 
 func NewHubCluster(config *rest.Config) (*Cluster, error) {
@@ -50,10 +57,14 @@ func NewHubCluster(config *rest.Config) (*Cluster, error) {
 		return nil, err
 	}
 	return &Cluster{
-		args,
+		Args: args,
 	}, nil
 }
 
+func (c *Cluster) resources() common.Resources {
+	return common.Resources{FS: f, Component: "hub", Overrides: c.Overrides}
+}
+
 func newConfigGetter(configV1 *clientcmdapiv1.Config) clientcmd.KubeconfigGetter {
 	return func() (*clientcmdapi.Config, error) {
 		newData, err := yaml.Marshal(configV1)
@@ -79,6 +90,11 @@ func ConvertSpokeKubeConfig(config *clientcmdapiv1.Config) (*rest.Config, error)
 }
 
 func (c *Cluster) GetSpokeClusterConfig(kubeconfig string) (*rest.Config, error) {
+	return LoadSpokeKubeConfig(kubeconfig)
+}
+
+// LoadSpokeKubeConfig parses the kubeconfig of spoke-cluster
+func LoadSpokeKubeConfig(kubeconfig string) (*rest.Config, error) {
 	spokeCmdV1Config := new(clientcmdapiv1.Config)
 	err := yaml.Unmarshal([]byte(kubeconfig), spokeCmdV1Config)
 	if err != nil {
@@ -87,10 +103,8 @@ func (c *Cluster) GetSpokeClusterConfig(kubeconfig string) (*rest.Config, error)
 	return ConvertSpokeKubeConfig(spokeCmdV1Config)
 }
 
-// GenerateHubClusterKubeConfig generate hub-cluster's kubeconfig for spoke-cluster
-func (c *Cluster) GenerateHubClusterKubeConfig(ctx context.Context, ip string) (*clientcmdapiv1.Config, error) {
-
-	// 1. get ca cert from configMap kube-public/cluster-info
+// GetHubClusterInfo gets the cluster info of hub-cluster, the server is replaced by ip if it's not empty
+func (c *Cluster) GetHubClusterInfo(ctx context.Context, ip string) (*clientcmdapiv1.Config, error) {
 	configMap := new(corev1.ConfigMap)
 	if err := c.Client.Get(ctx, client.ObjectKey{Name: "cluster-info", Namespace: "kube-public"}, configMap); err != nil {
 		return nil, err
@@ -102,12 +116,6 @@ func (c *Cluster) GenerateHubClusterKubeConfig(ctx context.Context, ip string) (
 		return nil, err
 	}
 
-	// 2. get token for spoke-cluster
-	token, err := c.GetHubUserToken(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	if len(kubeConfig.Clusters) != 1 {
 		klog.V(common.LogDebug).InfoS("the clusters num of kubeconfig was wrong", "expect", 1, "actual", len(kubeConfig.Clusters))
 		return nil, fmt.Errorf("the clusters num of kubeconfig was wrong expect %d actual %d", 1, len(kubeConfig.Clusters))
@@ -116,6 +124,24 @@ func (c *Cluster) GenerateHubClusterKubeConfig(ctx context.Context, ip string) (
 	if len(ip) != 0 {
 		kubeConfig.Clusters[0].Cluster.Server = ip
 	}
+	return kubeConfig, nil
+}
+
+// GenerateHubClusterKubeConfig generate hub-cluster's kubeconfig for spoke-cluster
+func (c *Cluster) GenerateHubClusterKubeConfig(ctx context.Context, ip string) (*clientcmdapiv1.Config, error) {
+
+	// 1. get ca cert from configMap kube-public/cluster-info
+	kubeConfig, err := c.GetHubClusterInfo(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. get token for spoke-cluster
+	token, err := c.GetHubUserToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	kubeConfig.Clusters[0].Name = common.HubClusterName
 	kubeConfig.Contexts = []clientcmdapiv1.NamedContext{
 		{
@@ -139,21 +165,72 @@ func (c *Cluster) GenerateHubClusterKubeConfig(ctx context.Context, ip string) (
 	return kubeConfig, nil
 }
 
-func (c *Cluster) GetHubUserToken(ctx context.Context) (string, error) {
-	var token string
-	var secretName string
+// RenderBootstrapResources renders the service account and RBAC used by spoke-clusters to bootstrap
+func (c *Cluster) RenderBootstrapResources() ([]*unstructured.Unstructured, error) {
+	resources := c.resources()
 	files := []string{
 		"resource/bootstrap_cluster_role.yaml",
 		"resource/bootstrap_sa_cluster_role_binding.yaml",
 		"resource/bootstrap_sa.yaml",
 	}
+	files = append(files, resources.ExtraFiles("resource")...)
+
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		fileObjects, err := resources.Objects(file)
+		if err != nil {
+			klog.Error(err, "Fail to load resource file ", "name:", file)
+			return nil, err
+		}
+		objects = append(objects, fileObjects...)
+	}
+	return objects, nil
+}
+
+// RenderManagedCluster renders the ManagedCluster accepted by hub-cluster
+func (c *Cluster) RenderManagedCluster(clusterName string, opts AcceptOptions) (*unstructured.Unstructured, error) {
+	mc := &ocmclusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: clusterName,
+		},
+		Spec: ocmclusterv1.ManagedClusterSpec{
+			HubAcceptsClient: true,
+		},
+	}
+	opts.apply(mc)
+	obj, err := common.ToUnstructured(mc)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.resources().Overrides.Patch(obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
 
-	// 1. create service account which grant related permissions to spoke-cluster
-	err := common.ApplyK8sResource(ctx, f, c.Client, files)
+func (c *Cluster) GetHubUserToken(ctx context.Context) (string, error) {
+	var token string
+	var secretName string
+
+	// 1. create service account which grant related permissions to spoke-cluster,
+	// together with the additional user provided resources
+	objects, err := c.RenderBootstrapResources()
+	if err != nil {
+		return token, err
+	}
+	// they are shared by the registrations of all spoke-clusters, so they aren't rolled back with a failed one
+	shared := c.Args
+	shared.Tracker = nil
+	err = shared.ApplyObjects(ctx, objects)
 	if err != nil {
 		return token, err
 	}
 
+	// never mint a token in dry-run
+	if c.DryRun {
+		return common.DryRunToken, nil
+	}
+
 	cs, err := kubernetes.NewForConfig(c.KubeConfig)
 	if err != nil {
 		return "", fmt.Errorf("failed to get clientset: %w", err)
@@ -204,8 +281,17 @@ func (c *Cluster) GetHubUserToken(ctx context.Context) (string, error) {
 }
 
 func (c *Cluster) RegisterSpokeCluster(ctx context.Context, clusterName string) error {
-
 	// 1. approve csr
+	if err := c.ApproveSpokeClusterCSR(ctx, clusterName); err != nil {
+		return err
+	}
+
+	// 2. update managed cluster
+	return c.AcceptSpokeCluster(ctx, clusterName, AcceptOptions{})
+}
+
+// ApproveSpokeClusterCSR approves the csr created by the registration agent of spoke-cluster
+func (c *Cluster) ApproveSpokeClusterCSR(ctx context.Context, clusterName string) error {
 	listOpts := []client.ListOption{
 		client.MatchingLabels{
 			clusterLabel: clusterName,
@@ -251,28 +337,100 @@ func (c *Cluster) RegisterSpokeCluster(ctx context.Context, clusterName string)
 			}
 
 			signingRequest := clientset.CertificatesV1().CertificateSigningRequests()
-			if _, err = signingRequest.UpdateApproval(ctx, csr.Name, &csr, metav1.UpdateOptions{}); err != nil {
+			if _, err = signingRequest.UpdateApproval(ctx, csr.Name, &csr, metav1.UpdateOptions{DryRun: c.DryRunOptions()}); err != nil {
 				return err
 			}
+			if !c.DryRun {
+				metrics.CSRs.WithLabelValues("approved").Inc()
+				metrics.CSRApprovalLatency.Observe(time.Since(csr.CreationTimestamp.Time).Seconds())
+			}
 		}
 	}
+	return nil
+}
 
-	// 2. update managed cluster
-	mc := new(ocmclusterv1.ManagedCluster)
-	err = c.Client.Get(ctx, client.ObjectKey{Name: clusterName}, mc)
-	if err != nil {
-		klog.V(common.LogDebug).InfoS("Fail to get managedCluster", "obj", klog.KObj(mc))
+// AcceptSpokeCluster sets HubAcceptsClient of the ManagedCluster
+func (c *Cluster) AcceptSpokeCluster(ctx context.Context, clusterName string, opts AcceptOptions) error {
+	var mc, previous *ocmclusterv1.ManagedCluster
+	changed := false
+	// the agent and the controllers of hub-cluster update the ManagedCluster concurrently
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		mc = new(ocmclusterv1.ManagedCluster)
+		if err := c.Client.Get(ctx, client.ObjectKey{Name: clusterName}, mc); err != nil {
+			klog.V(common.LogDebug).InfoS("Fail to get managedCluster", "obj", klog.KRef("", clusterName))
+			return err
+		}
+		previous = mc.DeepCopy()
+		mc.Spec.HubAcceptsClient = true
+		opts.apply(mc)
+		if changed = !equality.Semantic.DeepEqual(previous, mc); !changed {
+			return nil
+		}
+		return c.Client.Update(ctx, mc)
+	})
+	if err != nil || !changed {
 		return err
 	}
+	if !c.DryRun {
+		c.Tracker.RecordTyped(c.KubeConfig.Host, c.Client, mc, previous)
+	}
+	return nil
+}
 
-	if !mc.Spec.HubAcceptsClient {
-		mc.Spec.HubAcceptsClient = true
-		if err = c.Client.Update(ctx, mc); err != nil {
-			return nil
+// GetManagedCluster gets the ManagedCluster of clusterName
+func (c *Cluster) GetManagedCluster(ctx context.Context, clusterName string) (*ocmclusterv1.ManagedCluster, error) {
+	mc := new(ocmclusterv1.ManagedCluster)
+	if err := c.Client.Get(ctx, client.ObjectKey{Name: clusterName}, mc); err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+// DeleteManagedCluster deletes the ManagedCluster of clusterName, the hub-cluster cleans up its resources
+func (c *Cluster) DeleteManagedCluster(ctx context.Context, clusterName string) error {
+	mc := &ocmclusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName}}
+	klog.InfoS("delete managed cluster", "name", clusterName)
+	return client.IgnoreNotFound(c.Client.Delete(ctx, mc))
+}
+
+// WaitForSpokeClusterAvailable waits for the ManagedCluster to be available
+func (c *Cluster) WaitForSpokeClusterAvailable(ctx context.Context, clusterName string) error {
+	mc := new(ocmclusterv1.ManagedCluster)
+	startTime := time.Now()
+	return wait.PollUntilContextTimeout(ctx, 10*time.Second, 10*time.Minute, true, func(ctx context.Context) (done bool, err error) {
+		klog.V(common.LogDebug).InfoS("Waiting for managed cluster available", "waitTime", time.Since(startTime))
+		if err = c.Client.Get(ctx, client.ObjectKey{Name: clusterName}, mc); err != nil {
+			return false, nil
 		}
+		return meta.IsStatusConditionTrue(mc.Status.Conditions, ocmclusterv1.ManagedClusterConditionAvailable), nil
+	})
+}
+
+// ListSpokeClusterCSRs lists the csr created by the registration agent of spoke-cluster
+func (c *Cluster) ListSpokeClusterCSRs(ctx context.Context, clusterName string) ([]certificatesv1.CertificateSigningRequest, error) {
+	csrList := new(certificatesv1.CertificateSigningRequestList)
+	err := c.Client.List(ctx, csrList, client.MatchingLabels{clusterLabel: clusterName})
+	if err != nil {
+		return nil, err
 	}
+	return csrList.Items, nil
+}
 
-	return nil
+// GetSpokeClusterCSRStatus returns the names of the approved and denied csr of spoke-cluster
+func (c *Cluster) GetSpokeClusterCSRStatus(ctx context.Context, clusterName string) (approved, denied []string, err error) {
+	csrs, err := c.ListSpokeClusterCSRs(ctx, clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, csr := range csrs {
+		isApproved, isDenied := checkCsrStatus(&csr.Status)
+		if isDenied {
+			denied = append(denied, csr.Name)
+		} else if isApproved {
+			approved = append(approved, csr.Name)
+		}
+	}
+	return approved, denied, nil
 }
 
 func (c *Cluster) WaitForSpokeClusterReady(ctx context.Context, clusterName string) (bool, error) {
@@ -285,7 +443,7 @@ func (c *Cluster) WaitForSpokeClusterReady(ctx context.Context, clusterName stri
 	mc := new(ocmclusterv1.ManagedCluster)
 
 	startTime := time.Now()
-	err := wait.PollImmediate(10*time.Second, 10*time.Minute, func() (done bool, err error) {
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Second, 10*time.Minute, true, func(ctx context.Context) (done bool, err error) {
 		klog.V(common.LogDebug).InfoS("Waiting for register request", "waitTime", time.Since(startTime))
 		err = c.Client.List(ctx, csrList, listOpts...)
 		if err != nil {
@@ -345,7 +503,7 @@ func (c *Cluster) ApproveCSR(ctx context.Context, spokeClusterName string) error
 		if len(csr.Status.Certificate) == 0 {
 			_, err := nativeClient.CertificatesV1().
 				CertificateSigningRequests().
-				UpdateApproval(ctx, csr.Name, &csr, metav1.UpdateOptions{})
+				UpdateApproval(ctx, csr.Name, &csr, metav1.UpdateOptions{DryRun: c.DryRunOptions()})
 			if err != nil {
 				return errors.Wrapf(err, "failed approving CSR %q for cluster %q", csr.Name, spokeClusterName)
 			}
@@ -365,3 +523,29 @@ func checkCsrStatus(status *certificatesv1.CertificateSigningRequestStatus) (app
 	}
 	return
 }
+
+// ListManagedClusters lists the ManagedClusters with the annotation, all of them if annotation is empty
+func (c *Cluster) ListManagedClusters(ctx context.Context, annotation string) ([]ocmclusterv1.ManagedCluster, error) {
+	list := new(ocmclusterv1.ManagedClusterList)
+	if err := c.Client.List(ctx, list); err != nil {
+		return nil, err
+	}
+	var res []ocmclusterv1.ManagedCluster
+	for _, mc := range list.Items {
+		if _, ok := mc.Annotations[annotation]; ok || len(annotation) == 0 {
+			res = append(res, mc)
+		}
+	}
+	return res, nil
+}
+
+// SetManagedClusterAnnotation sets an annotation of the ManagedCluster which isn't reconciled by AcceptOptions
+func (c *Cluster) SetManagedClusterAnnotation(ctx context.Context, clusterName, key, value string) error {
+	mc, err := c.GetManagedCluster(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+	patched := mc.DeepCopy()
+	metav1.SetMetaDataAnnotation(&patched.ObjectMeta, key, value)
+	return c.Client.Patch(ctx, patched, client.MergeFrom(mc))
+}
@@ -0,0 +1,126 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	ocmworkv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	// BaselineLabel marks the ManifestWorks delivering the baseline manifests
+	BaselineLabel = "cluster-register.oam.dev/baseline"
+	// baselinePrefix is the name prefix of the baseline ManifestWorks
+	baselinePrefix = "baseline-"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// RenderBaselineWorks wraps the baseline manifests into ManifestWorks of the managed cluster, one for each file
+func (c *Cluster) RenderBaselineWorks(clusterName string, files map[string][]byte) ([]*unstructured.Unstructured, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var works []*unstructured.Unstructured
+	// files mapped to the same ManifestWork would overwrite each other
+	workFiles := map[string]string{}
+	for _, file := range names {
+		objects, err := common.DecodeObjects(files[file])
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode baseline %s: %w", file, err)
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		workName := baselineWorkName(file)
+		if errs := validation.IsDNS1123Subdomain(workName); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid ManifestWork name %s of baseline %s: %s", workName, file, strings.Join(errs, ", "))
+		}
+		if other, ok := workFiles[workName]; ok {
+			return nil, fmt.Errorf("baseline %s and %s are both wrapped into ManifestWork %s, rename one of them", other, file, workName)
+		}
+		workFiles[workName] = file
+		work := &ocmworkv1.ManifestWork{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      workName,
+				Namespace: clusterName,
+				Labels:    map[string]string{BaselineLabel: "true"},
+			},
+		}
+		for _, obj := range objects {
+			work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests, ocmworkv1.Manifest{
+				RawExtension: runtime.RawExtension{Object: obj},
+			})
+		}
+		u, err := common.ToUnstructured(work)
+		if err != nil {
+			return nil, err
+		}
+		works = append(works, u)
+	}
+	return works, nil
+}
+
+// baselineWorkName derives a valid ManifestWork name from a file name
+func baselineWorkName(file string) string {
+	name := strings.ToLower(strings.TrimSuffix(file, filepath.Ext(file)))
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-")
+	return baselinePrefix + name
+}
+
+// ApplyBaseline creates or updates the baseline ManifestWorks of the managed cluster, and returns their names
+func (c *Cluster) ApplyBaseline(ctx context.Context, clusterName string, files map[string][]byte) ([]string, error) {
+	works, err := c.RenderBaselineWorks(clusterName, files)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.ApplyObjects(ctx, works); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(works))
+	for _, work := range works {
+		names = append(names, work.GetName())
+	}
+	return names, nil
+}
+
+// WaitForWorksApplied waits for the ManifestWorks of the managed cluster to be applied by the work agent
+func (c *Cluster) WaitForWorksApplied(ctx context.Context, clusterName string, names []string, timeout time.Duration) error {
+	startTime := time.Now()
+	pending := names
+	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		klog.V(common.LogDebug).InfoS("Waiting for ManifestWorks applied", "pending", pending, "waitTime", time.Since(startTime))
+		var notApplied []string
+		for _, name := range pending {
+			work := new(ocmworkv1.ManifestWork)
+			if err := c.Client.Get(ctx, client.ObjectKey{Namespace: clusterName, Name: name}, work); err != nil ||
+				!meta.IsStatusConditionTrue(work.Status.Conditions, ocmworkv1.WorkApplied) {
+				notApplied = append(notApplied, name)
+			}
+		}
+		pending = notApplied
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("ManifestWorks %v of cluster %s aren't applied after %s", pending, clusterName, timeout)
+	}
+	return nil
+}
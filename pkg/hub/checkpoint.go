@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	checkpointPrefix = "cluster-register-"
+	// CheckpointClusterLabel is the label of checkpoint ConfigMap whose value is the name of managed cluster
+	CheckpointClusterLabel = "cluster-register.oam.dev/cluster-name"
+	// checkpointOptionsAnnotation is the annotation of checkpoint ConfigMap whose value is the hash of the options
+	// the phases are completed with
+	checkpointOptionsAnnotation = "cluster-register.oam.dev/options-hash"
+)
+
+// Checkpoint records the completed phases of a registration in a ConfigMap on hub-cluster,
+// so that a rerun of the registration can skip them.
+// The ConfigMap maps the name of each completed phase to its completion time.
+// The phases are only skipped by a rerun with the same options.
+type Checkpoint struct {
+	client    client.Client
+	configMap *corev1.ConfigMap
+}
+
+// LoadCheckpoint gets the checkpoint of clusterName for the options of optionsHash, an empty checkpoint is returned
+// if there is none, or if the checkpoint is recorded with other options
+func (c *Cluster) LoadCheckpoint(ctx context.Context, clusterName string, optionsHash string) (*Checkpoint, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      checkpointPrefix + clusterName,
+			Namespace: common.OpenClusterManagementNamespace,
+			Labels:    map[string]string{CheckpointClusterLabel: clusterName},
+		},
+	}
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(cm), cm)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return nil, err
+	}
+	cp := &Checkpoint{client: c.Client, configMap: cm}
+	if previous := cm.Annotations[checkpointOptionsAnnotation]; len(cm.ResourceVersion) != 0 && previous != optionsHash {
+		klog.InfoS("options are changed since the checkpoint, run all phases again", "name", clusterName,
+			"previous", previous, "current", optionsHash)
+		if err = cp.Reset(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[checkpointOptionsAnnotation] = optionsHash
+	return cp, nil
+}
+
+// Completed returns whether the phase was completed by a previous run
+func (cp *Checkpoint) Completed(phase string) bool {
+	_, ok := cp.configMap.Data[phase]
+	return ok
+}
+
+// Complete records phase as completed
+func (cp *Checkpoint) Complete(ctx context.Context, phase string) error {
+	if cp.configMap.Data == nil {
+		cp.configMap.Data = map[string]string{}
+	}
+	cp.configMap.Data[phase] = time.Now().UTC().Format(time.RFC3339)
+	if len(cp.configMap.ResourceVersion) == 0 {
+		return cp.client.Create(ctx, cp.configMap)
+	}
+	return cp.client.Update(ctx, cp.configMap)
+}
+
+// Reset forgets all the completed phases
+func (cp *Checkpoint) Reset(ctx context.Context) error {
+	cp.configMap.Data = nil
+	if len(cp.configMap.ResourceVersion) == 0 {
+		return nil
+	}
+	klog.V(common.LogDebug).InfoS("delete checkpoint", "object", klog.KObj(cp.configMap))
+	if err := cp.client.Delete(ctx, cp.configMap); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	cp.configMap.ResourceVersion = ""
+	return nil
+}
+
+// TokenValid returns whether a bootstrap token is still valid for the given duration.
+// Tokens without expiration, e.g. legacy service account tokens, are always valid.
+func TokenValid(token string, duration time.Duration) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return true
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return false
+	}
+	if claims.Exp == 0 {
+		return true
+	}
+	return time.Now().Add(duration).Before(time.Unix(claims.Exp, 0))
+}
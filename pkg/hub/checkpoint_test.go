@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	c := &Cluster{Args: common.Args{Client: fake.NewClientBuilder().WithScheme(common.Scheme).Build()}}
+
+	cp, err := c.LoadCheckpoint(ctx, "a", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed("install") {
+		t.Fatal("expect no completed phase in a new checkpoint")
+	}
+	for _, phase := range []string{"install", "join"} {
+		if err = cp.Complete(ctx, phase); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a rerun skips the completed phases
+	if cp, err = c.LoadCheckpoint(ctx, "a", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Completed("install") || !cp.Completed("join") || cp.Completed("accept") {
+		t.Errorf("expect install and join to be completed, got %v", cp.configMap.Data)
+	}
+	if cp.configMap.Labels[CheckpointClusterLabel] != "a" {
+		t.Errorf("expect the checkpoint to be labeled with its cluster, got %v", cp.configMap.Labels)
+	}
+	if other, err := c.LoadCheckpoint(ctx, "b", "hash"); err != nil || other.Completed("install") {
+		t.Errorf("expect the checkpoint of another cluster to be empty, got %v, %v", other, err)
+	}
+
+	if err = cp.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed("install") {
+		t.Error("expect no completed phase after reset")
+	}
+	if err = cp.Complete(ctx, "join"); err != nil {
+		t.Fatalf("expect the reset checkpoint to be recreated, got %v", err)
+	}
+	if cp, err = c.LoadCheckpoint(ctx, "a", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed("install") || !cp.Completed("join") {
+		t.Errorf("expect only join to be completed, got %v", cp.configMap.Data)
+	}
+
+	// the phases completed with other options are run again
+	if cp, err = c.LoadCheckpoint(ctx, "a", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed("join") {
+		t.Errorf("expect no completed phase with other options, got %v", cp.configMap.Data)
+	}
+	if err = cp.Complete(ctx, "install"); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err = c.LoadCheckpoint(ctx, "a", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Completed("install") || cp.Completed("join") {
+		t.Errorf("expect only install to be completed, got %v", cp.configMap.Data)
+	}
+}
+
+func TestTokenValid(t *testing.T) {
+	jwt := func(payload string) string {
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+	exp := func(d time.Duration) string {
+		return jwt(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(d).Unix()))
+	}
+	cases := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "bootstrap token", token: "abcdef.0123456789abcdef", want: true},
+		{name: "without expiration", token: jwt(`{"sub":"system:serviceaccount:open-cluster-management:cluster-bootstrap"}`), want: true},
+		{name: "expires after the duration", token: exp(2 * time.Hour), want: true},
+		{name: "expires within the duration", token: exp(30 * time.Minute), want: false},
+		{name: "expired", token: exp(-time.Hour), want: false},
+		{name: "malformed payload", token: "a.!!!.c", want: false},
+		{name: "payload isn't json", token: jwt("exp"), want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := TokenValid(c.token, time.Hour); got != c.want {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
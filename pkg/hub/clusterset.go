@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+// RenderManagedClusterSet renders the ManagedClusterSet selecting its clusters by the clusterset label,
+// together with a ManagedClusterSetBinding into each of namespaces
+func (c *Cluster) RenderManagedClusterSet(clusterSet string, namespaces []string) ([]*unstructured.Unstructured, error) {
+	objects := []client.Object{&ocmclusterv1beta2.ManagedClusterSet{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterSet},
+		Spec: ocmclusterv1beta2.ManagedClusterSetSpec{
+			ClusterSelector: ocmclusterv1beta2.ManagedClusterSelector{
+				SelectorType: ocmclusterv1beta2.ExclusiveClusterSetLabel,
+			},
+		},
+	}}
+	for _, namespace := range namespaces {
+		objects = append(objects, &ocmclusterv1beta2.ManagedClusterSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterSet, Namespace: namespace},
+			Spec:       ocmclusterv1beta2.ManagedClusterSetBindingSpec{ClusterSet: clusterSet},
+		})
+	}
+
+	var res []*unstructured.Unstructured
+	for _, obj := range objects {
+		u, err := common.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.resources().Overrides.Patch(u); err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+// EnsureManagedClusterSet creates the ManagedClusterSet and its bindings into namespaces if they don't exist.
+// The existing ones are left untouched, they may be shared by other clusters.
+func (c *Cluster) EnsureManagedClusterSet(ctx context.Context, clusterSet string, namespaces []string) error {
+	objects, err := c.RenderManagedClusterSet(clusterSet, namespaces)
+	if err != nil {
+		return err
+	}
+	return c.CreateObjects(ctx, objects)
+}
+
+// ListManagedClusterSetBindingNamespaces lists the namespaces the ManagedClusterSet is bound to, ordered by name
+func (c *Cluster) ListManagedClusterSetBindingNamespaces(ctx context.Context, clusterSet string) ([]string, error) {
+	bindings := new(ocmclusterv1beta2.ManagedClusterSetBindingList)
+	if err := c.Client.List(ctx, bindings); err != nil {
+		// no cluster set is bound before cluster manager is installed
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var namespaces []string
+	for _, binding := range bindings.Items {
+		if binding.Spec.ClusterSet == clusterSet {
+			namespaces = append(namespaces, binding.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
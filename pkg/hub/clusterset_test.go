@@ -0,0 +1,35 @@
+package hub
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+func TestListManagedClusterSetBindingNamespaces(t *testing.T) {
+	binding := func(namespace, clusterSet string) *ocmclusterv1beta2.ManagedClusterSetBinding {
+		return &ocmclusterv1beta2.ManagedClusterSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: clusterSet},
+			Spec:       ocmclusterv1beta2.ManagedClusterSetBindingSpec{ClusterSet: clusterSet},
+		}
+	}
+	c := &Cluster{Args: common.Args{Client: fake.NewClientBuilder().WithScheme(common.Scheme).
+		WithObjects(binding("team-b", "prod"), binding("team-a", "prod"), binding("team-a", "dev")).Build()}}
+
+	got, err := c.ListManagedClusterSetBindingNamespaces(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"team-a", "team-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expect %v, got %v", want, got)
+	}
+	if got, err = c.ListManagedClusterSetBindingNamespaces(context.Background(), "staging"); err != nil || len(got) != 0 {
+		t.Errorf("expect no binding, got %v, %v", got, err)
+	}
+}
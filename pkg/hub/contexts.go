@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+)
+
+// KubeConfigContext is a spoke-cluster given by a context of kubeconfig
+type KubeConfigContext struct {
+	// Context is the name of the context in kubeconfig
+	Context string
+	// ClusterName is the name of ManagedCluster, sanitized from the context name
+	ClusterName string
+	Config      *rest.Config
+	// Err is why the context can't be registered, e.g. its cluster name is invalid or taken by another context
+	Err error
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// SanitizeClusterName converts name to a valid DNS-1123 label, e.g. arn:aws:eks:us-east-1:1234:cluster/prod
+// to arn-aws-eks-us-east-1-1234-cluster-prod
+func SanitizeClusterName(name string) string {
+	name = invalidLabelChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = name[:validation.DNS1123LabelMaxLength]
+	}
+	return strings.Trim(name, "-")
+}
+
+// SplitKubeConfigContexts returns a spoke-cluster for every context of kubeconfig matching filter, all of them if
+// filter is nil, ordered by the context name. A context which can't be registered is returned with Err, and the
+// contexts sharing a cluster name are all refused.
+func SplitKubeConfigContexts(kubeconfig string, filter *regexp.Regexp) ([]KubeConfigContext, error) {
+	config := new(clientcmdapiv1.Config)
+	if err := yaml.Unmarshal([]byte(kubeconfig), config); err != nil {
+		return nil, err
+	}
+
+	var res []KubeConfigContext
+	for _, c := range config.Contexts {
+		if filter != nil && !filter.MatchString(c.Name) {
+			continue
+		}
+		kc := KubeConfigContext{Context: c.Name, ClusterName: SanitizeClusterName(c.Name)}
+		if errs := validation.IsDNS1123Label(kc.ClusterName); len(errs) != 0 {
+			kc.Err = fmt.Errorf("context %q isn't a valid cluster name: %s", c.Name, strings.Join(errs, ", "))
+			res = append(res, kc)
+			continue
+		}
+		contextConfig := config.DeepCopy()
+		contextConfig.CurrentContext = c.Name
+		var err error
+		if kc.Config, err = ConvertSpokeKubeConfig(contextConfig); err != nil {
+			kc.Err = fmt.Errorf("fail to load context %q: %w", c.Name, err)
+		}
+		res = append(res, kc)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Context < res[j].Context })
+
+	contexts := map[string][]int{}
+	for i, kc := range res {
+		if len(kc.ClusterName) != 0 {
+			contexts[kc.ClusterName] = append(contexts[kc.ClusterName], i)
+		}
+	}
+	for name, indexes := range contexts {
+		if len(indexes) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(indexes))
+		for _, i := range indexes {
+			names = append(names, fmt.Sprintf("%q", res[i].Context))
+		}
+		for _, i := range indexes {
+			res[i].Err = fmt.Errorf("contexts %s have the same cluster name %s", strings.Join(names, ", "), name)
+		}
+	}
+	return res, nil
+}
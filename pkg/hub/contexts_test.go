@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeClusterName(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "valid", in: "prod", want: "prod"},
+		{name: "lower case", in: "Prod-EU", want: "prod-eu"},
+		{name: "eks arn", in: "arn:aws:eks:us-east-1:1234:cluster/prod", want: "arn-aws-eks-us-east-1-1234-cluster-prod"},
+		{name: "gke", in: "gke_project_europe-west1_prod", want: "gke-project-europe-west1-prod"},
+		{name: "invalid characters are merged", in: "a@@b..c", want: "a-b-c"},
+		{name: "leading and trailing dashes are trimmed", in: "_-a-_", want: "a"},
+		{name: "nothing valid", in: "@@@", want: ""},
+		{name: "truncated", in: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+		{name: "trimmed after truncation", in: strings.Repeat("a", 62) + "/b", want: strings.Repeat("a", 62)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := SanitizeClusterName(c.in); got != c.want {
+				t.Errorf("expect %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSplitKubeConfigContexts(t *testing.T) {
+	kubeconfig := func(contexts ...string) string {
+		var b strings.Builder
+		b.WriteString("apiVersion: v1\nkind: Config\nclusters:\n- name: c\n  cluster:\n    server: https://127.0.0.1:6443\n")
+		b.WriteString("users:\n- name: u\n  user:\n    token: t\ncontexts:\n")
+		for _, c := range contexts {
+			b.WriteString("- name: \"" + c + "\"\n  context:\n    cluster: c\n    user: u\n")
+		}
+		return b.String()
+	}
+	// want maps the context to its cluster name, suffixed by "!" if the context is refused
+	cases := []struct {
+		name     string
+		contexts []string
+		filter   string
+		want     map[string]string
+	}{
+		{name: "no context", want: map[string]string{}},
+		{
+			name:     "filtered",
+			contexts: []string{"prod-a", "dev-a"},
+			filter:   "^prod-",
+			want:     map[string]string{"prod-a": "prod-a"},
+		},
+		{
+			name:     "sanitized",
+			contexts: []string{"arn:aws:eks:us-east-1:1234:cluster/prod"},
+			want:     map[string]string{"arn:aws:eks:us-east-1:1234:cluster/prod": "arn-aws-eks-us-east-1-1234-cluster-prod"},
+		},
+		{
+			name:     "invalid name is refused alone",
+			contexts: []string{"@@@", "a"},
+			want:     map[string]string{"@@@": "!", "a": "a"},
+		},
+		{
+			name:     "collisions are refused",
+			contexts: []string{"Prod", "prod", "prod/", "dev"},
+			want:     map[string]string{"Prod": "prod!", "prod": "prod!", "prod/": "prod!", "dev": "dev"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var filter *regexp.Regexp
+			if len(c.filter) != 0 {
+				filter = regexp.MustCompile(c.filter)
+			}
+			contexts, err := SplitKubeConfigContexts(kubeconfig(c.contexts...), filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for i, kc := range contexts {
+				if i != 0 && contexts[i-1].Context >= kc.Context {
+					t.Errorf("contexts aren't ordered by name: %s, %s", contexts[i-1].Context, kc.Context)
+				}
+				got[kc.Context] = kc.ClusterName
+				if kc.Err != nil {
+					got[kc.Context] += "!"
+				} else if kc.Config == nil || kc.Config.BearerToken != "t" {
+					t.Errorf("unexpected config of context %s", kc.Context)
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	// EventComponent is the source component of the events
+	EventComponent = "cluster-register"
+	// eventNamespace is where the events of cluster scoped objects are created
+	eventNamespace = metav1.NamespaceDefault
+)
+
+// EventRecorder emits the events of registrations on hub-cluster. The events are created synchronously,
+// so that none of them is lost when the Job exits.
+type EventRecorder struct {
+	client client.Client
+	// pod is the pod running the registration, the events are attached to it before the ManagedCluster exists
+	pod *corev1.ObjectReference
+	// host is the reporting instance of the events
+	host string
+}
+
+// NewEventRecorder creates the event recorder with the client of hub-cluster, the pod is given by the
+// POD_NAMESPACE and POD_NAME env
+func NewEventRecorder(c client.Client) *EventRecorder {
+	recorder := &EventRecorder{client: c}
+	recorder.host, _ = os.Hostname()
+	namespace, name := os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME")
+	if len(namespace) != 0 && len(name) != 0 {
+		recorder.pod = &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name}
+	}
+	return recorder
+}
+
+// Event emits an event of the registration of clusterName, eventType is corev1.EventTypeNormal or
+// corev1.EventTypeWarning. Nothing is emitted without a recorder or in dry-run, and failing to emit is only logged.
+func (c *Cluster) Event(ctx context.Context, clusterName, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.Recorder == nil || c.DryRun {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+	if err := c.Recorder.emit(ctx, clusterName, eventType, reason, message); err != nil {
+		klog.V(common.LogDebug).InfoS("Fail to emit event", "name", clusterName, "reason", reason, "err", err)
+	}
+}
+
+func (r *EventRecorder) emit(ctx context.Context, clusterName, eventType, reason, message string) error {
+	involved, err := r.involvedObject(ctx, clusterName)
+	if err != nil || involved == nil {
+		return err
+	}
+	namespace := involved.Namespace
+	if len(namespace) == 0 {
+		namespace = eventNamespace
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", involved.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject:      *involved,
+		Reason:              reason,
+		Message:             fmt.Sprintf("[%s] %s", clusterName, message),
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: EventComponent, Host: r.host},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: EventComponent,
+		ReportingInstance:   r.host,
+	}
+	return r.client.Create(ctx, event)
+}
+
+// involvedObject is the ManagedCluster if it exists, otherwise the pod running the registration if known
+func (r *EventRecorder) involvedObject(ctx context.Context, clusterName string) (*corev1.ObjectReference, error) {
+	mc := new(ocmclusterv1.ManagedCluster)
+	err := r.client.Get(ctx, client.ObjectKey{Name: clusterName}, mc)
+	if err == nil {
+		return &corev1.ObjectReference{
+			APIVersion:      ocmclusterv1.GroupVersion.String(),
+			Kind:            "ManagedCluster",
+			Name:            mc.Name,
+			UID:             mc.UID,
+			ResourceVersion: mc.ResourceVersion,
+		}, nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return nil, err
+	}
+	return r.pod, nil
+}
@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// FingerprintAnnotation is the annotation of ManagedCluster whose value identifies the physical spoke-cluster
+const FingerprintAnnotation = "cluster-register.oam.dev/fingerprint"
+
+// clusterIDClaim is the well-known ClusterClaim of the unique identifier of a cluster, its value is the fingerprint
+// if it's created by cluster-register
+const clusterIDClaim = "id.k8s.io"
+
+// CheckFingerprint checks that neither the spoke-cluster is registered under another name,
+// nor another spoke-cluster is registered under clusterName.
+// The ManagedCluster of renamedFrom is being renamed to clusterName, it isn't a duplicate.
+func (c *Cluster) CheckFingerprint(ctx context.Context, clusterName string, fingerprint string, renamedFrom string) error {
+	mcList := new(ocmclusterv1.ManagedClusterList)
+	if err := c.Client.List(ctx, mcList); err != nil {
+		// no cluster is registered before cluster manager is installed
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	for _, mc := range mcList.Items {
+		existing, ok := fingerprintOf(&mc)
+		if !ok {
+			continue
+		}
+		if mc.Name != clusterName && mc.Name != renamedFrom && existing == fingerprint {
+			return fmt.Errorf("spoke-cluster is already registered as %s, rename or duplicate is refused", mc.Name)
+		}
+		if mc.Name == clusterName && existing != fingerprint {
+			return fmt.Errorf("name collision, %s is registered by another spoke-cluster with fingerprint %s", clusterName, existing)
+		}
+	}
+	return nil
+}
+
+// fingerprintOf returns the fingerprint recorded on the ManagedCluster, or the cluster id claim reported by its agent
+// if the ManagedCluster is registered before the fingerprint is recorded
+func fingerprintOf(mc *ocmclusterv1.ManagedCluster) (string, bool) {
+	if fingerprint, ok := mc.Annotations[FingerprintAnnotation]; ok {
+		return fingerprint, true
+	}
+	for _, claim := range mc.Status.ClusterClaims {
+		if claim.Name == clusterIDClaim && len(claim.Value) != 0 {
+			return claim.Value, true
+		}
+	}
+	return "", false
+}
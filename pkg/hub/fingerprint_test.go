@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+func TestCheckFingerprint(t *testing.T) {
+	managedCluster := func(name, fingerprint string) *ocmclusterv1.ManagedCluster {
+		mc := &ocmclusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if len(fingerprint) != 0 {
+			mc.Annotations = map[string]string{FingerprintAnnotation: fingerprint}
+		}
+		return mc
+	}
+	claimed := func(name, id string) *ocmclusterv1.ManagedCluster {
+		mc := managedCluster(name, "")
+		mc.Status.ClusterClaims = []ocmclusterv1.ManagedClusterClaim{{Name: clusterIDClaim, Value: id}}
+		return mc
+	}
+	cases := []struct {
+		name        string
+		existing    []client.Object
+		cluster     string
+		renamedFrom string
+		wantErr     bool
+	}{
+		{name: "first registration", cluster: "a"},
+		{name: "rerun", existing: []client.Object{managedCluster("a", "fp-a")}, cluster: "a"},
+		{name: "registered before the fingerprint is recorded", existing: []client.Object{managedCluster("a", "")}, cluster: "a"},
+		{name: "other clusters", existing: []client.Object{managedCluster("b", "fp-b"), managedCluster("c", "")}, cluster: "a"},
+		{name: "duplicate", existing: []client.Object{managedCluster("b", "fp-a")}, cluster: "a", wantErr: true},
+		{name: "name collision", existing: []client.Object{managedCluster("a", "fp-b")}, cluster: "a", wantErr: true},
+		{name: "rename", existing: []client.Object{managedCluster("b", "fp-a")}, cluster: "a", renamedFrom: "b"},
+		{name: "rename of another cluster", existing: []client.Object{managedCluster("b", "fp-a")}, cluster: "a", renamedFrom: "c", wantErr: true},
+		{name: "duplicate by cluster id claim", existing: []client.Object{claimed("b", "fp-a")}, cluster: "a", wantErr: true},
+		{name: "name collision by cluster id claim", existing: []client.Object{claimed("a", "fp-b")}, cluster: "a", wantErr: true},
+		{name: "annotation wins over cluster id claim", existing: []client.Object{func() client.Object {
+			mc := claimed("a", "fp-b")
+			mc.Annotations = map[string]string{FingerprintAnnotation: "fp-a"}
+			return mc
+		}()}, cluster: "a"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hubCluster := &Cluster{Args: common.Args{
+				Client: fake.NewClientBuilder().WithScheme(common.Scheme).WithObjects(c.existing...).Build(),
+			}}
+			err := hubCluster.CheckFingerprint(context.Background(), c.cluster, "fp-a", c.renamedFrom)
+			if (err != nil) != c.wantErr {
+				t.Errorf("expect error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
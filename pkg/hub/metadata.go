@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const (
+	// managedLabelsAnnotation lists the label keys set by the registration, so that removed labels can be reconciled
+	managedLabelsAnnotation = "cluster-register.oam.dev/managed-labels"
+	// managedAnnotationsAnnotation lists the annotation keys set by the registration
+	managedAnnotationsAnnotation = "cluster-register.oam.dev/managed-annotations"
+	// managedTaintsAnnotation lists the <key>:<effect> of the taints set by the registration
+	managedTaintsAnnotation = "cluster-register.oam.dev/managed-taints"
+)
+
+// AcceptOptions are applied to the ManagedCluster together with accepting it,
+// so that the cluster is never schedulable without them.
+// The labels, annotations and taints set by a previous registration but not by this one are removed.
+type AcceptOptions struct {
+	Labels      map[string]string
+	Annotations map[string]string
+	Taints      []ocmclusterv1.Taint
+}
+
+func (opts AcceptOptions) apply(mc *ocmclusterv1.ManagedCluster) {
+	for _, k := range managedKeys(mc, managedLabelsAnnotation).List() {
+		if _, ok := opts.Labels[k]; !ok {
+			delete(mc.Labels, k)
+		}
+	}
+	for _, k := range managedKeys(mc, managedAnnotationsAnnotation).List() {
+		if _, ok := opts.Annotations[k]; !ok {
+			delete(mc.Annotations, k)
+		}
+	}
+	desiredTaints := sets.NewString()
+	for _, taint := range opts.Taints {
+		desiredTaints.Insert(taintKey(taint))
+	}
+	staleTaints := managedKeys(mc, managedTaintsAnnotation).Difference(desiredTaints)
+	var taints []ocmclusterv1.Taint
+	for _, taint := range mc.Spec.Taints {
+		if !staleTaints.Has(taintKey(taint)) {
+			taints = append(taints, taint)
+		}
+	}
+	mc.Spec.Taints = taints
+
+	for k, v := range opts.Labels {
+		metav1.SetMetaDataLabel(&mc.ObjectMeta, k, v)
+	}
+	for k, v := range opts.Annotations {
+		metav1.SetMetaDataAnnotation(&mc.ObjectMeta, k, v)
+	}
+	for _, taint := range opts.Taints {
+		mc.Spec.Taints = setTaint(mc.Spec.Taints, taint)
+	}
+
+	setManagedKeys(mc, managedLabelsAnnotation, sets.StringKeySet(opts.Labels))
+	setManagedKeys(mc, managedAnnotationsAnnotation, sets.StringKeySet(opts.Annotations))
+	setManagedKeys(mc, managedTaintsAnnotation, desiredTaints)
+}
+
+func managedKeys(mc *ocmclusterv1.ManagedCluster, annotation string) sets.String {
+	value := mc.Annotations[annotation]
+	if len(value) == 0 {
+		return sets.NewString()
+	}
+	return sets.NewString(strings.Split(value, ",")...)
+}
+
+func setManagedKeys(mc *ocmclusterv1.ManagedCluster, annotation string, keys sets.String) {
+	if keys.Len() == 0 {
+		delete(mc.Annotations, annotation)
+		return
+	}
+	metav1.SetMetaDataAnnotation(&mc.ObjectMeta, annotation, strings.Join(keys.List(), ","))
+}
+
+func taintKey(taint ocmclusterv1.Taint) string {
+	return taint.Key + ":" + string(taint.Effect)
+}
+
+// setTaint adds or replaces the taint with the same key and effect, the time added of an unchanged taint is kept
+func setTaint(taints []ocmclusterv1.Taint, taint ocmclusterv1.Taint) []ocmclusterv1.Taint {
+	for i, t := range taints {
+		if t.Key != taint.Key || t.Effect != taint.Effect {
+			continue
+		}
+		if t.Value != taint.Value {
+			taint.TimeAdded = metav1.Now()
+			taints[i] = taint
+		}
+		return taints
+	}
+	taint.TimeAdded = metav1.Now()
+	return append(taints, taint)
+}
+
+// ParseLabels parses labels in the form of k1=v1,k2=v2
+func ParseLabels(s string) (map[string]string, error) {
+	labels, err := ParseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range labels {
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid value of label %s: %s", k, strings.Join(errs, ", "))
+		}
+	}
+	return labels, nil
+}
+
+// ParseKeyValues parses annotations in the form of k1=v1,k2=v2
+func ParseKeyValues(s string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, item := range splitList(s) {
+		k, v, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid %q, expect <key>=<value>", item)
+		}
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid key %s: %s", k, strings.Join(errs, ", "))
+		}
+		res[k] = v
+	}
+	return res, nil
+}
+
+// ParseTaints parses taints in the form of key1=value1:Effect1,key2:Effect2
+func ParseTaints(s string) ([]ocmclusterv1.Taint, error) {
+	var taints []ocmclusterv1.Taint
+	for _, item := range splitList(s) {
+		kv, effect, found := strings.Cut(item, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid taint %q, expect <key>[=<value>]:<effect>", item)
+		}
+		switch ocmclusterv1.TaintEffect(effect) {
+		case ocmclusterv1.TaintEffectNoSelect, ocmclusterv1.TaintEffectPreferNoSelect, ocmclusterv1.TaintEffectNoSelectIfNew:
+		default:
+			return nil, fmt.Errorf("invalid effect of taint %q", item)
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid key of taint %q: %s", item, strings.Join(errs, ", "))
+		}
+		taints = append(taints, ocmclusterv1.Taint{Key: k, Value: v, Effect: ocmclusterv1.TaintEffect(effect)})
+	}
+	sort.SliceStable(taints, func(i, j int) bool { return taintKey(taints[i]) < taintKey(taints[j]) })
+	return taints, nil
+}
+
+// ParseNamespaces parses namespaces in the form of ns1,ns2
+func ParseNamespaces(s string) ([]string, error) {
+	namespaces := splitList(s)
+	for _, ns := range namespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+	}
+	return namespaces, nil
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"reflect"
+	"testing"
+
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	cases := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: map[string]string{}},
+		{name: "trimmed", s: " env=prod , team=a ,", want: map[string]string{"env": "prod", "team": "a"}},
+		{name: "empty value", s: "env=", want: map[string]string{"env": ""}},
+		{name: "value with equal sign", s: "k=a=b", want: map[string]string{"k": "a=b"}},
+		{name: "prefixed key", s: "example.com/env=prod", want: map[string]string{"example.com/env": "prod"}},
+		{name: "later wins", s: "env=dev,env=prod", want: map[string]string{"env": "prod"}},
+		{name: "missing value", s: "env", wantErr: true},
+		{name: "invalid key", s: "-env=prod", wantErr: true},
+		{name: "empty key", s: "=prod", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseKeyValues(c.s)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expect error %v, got %v", c.wantErr, err)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTaints(t *testing.T) {
+	cases := []struct {
+		name    string
+		s       string
+		want    []ocmclusterv1.Taint
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: nil},
+		{
+			name: "sorted by key",
+			s:    "b=1:NoSelect, a:PreferNoSelect",
+			want: []ocmclusterv1.Taint{
+				{Key: "a", Effect: ocmclusterv1.TaintEffectPreferNoSelect},
+				{Key: "b", Value: "1", Effect: ocmclusterv1.TaintEffectNoSelect},
+			},
+		},
+		{
+			name: "same key with different effects",
+			s:    "a:NoSelectIfNew,a:NoSelect",
+			want: []ocmclusterv1.Taint{
+				{Key: "a", Effect: ocmclusterv1.TaintEffectNoSelect},
+				{Key: "a", Effect: ocmclusterv1.TaintEffectNoSelectIfNew},
+			},
+		},
+		{name: "missing effect", s: "a=1", wantErr: true},
+		{name: "empty effect", s: "a=1:", wantErr: true},
+		{name: "unknown effect", s: "a=1:NoSchedule", wantErr: true},
+		{name: "invalid key", s: "a b=1:NoSelect", wantErr: true},
+		{name: "empty key", s: "=1:NoSelect", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseTaints(c.s)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expect error %v, got %v", c.wantErr, err)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+// ProvisionOptions are the spec of a ManagedCluster set by the hub-cluster instead of the agent
+type ProvisionOptions struct {
+	LeaseDurationSeconds int32
+	ClientConfigs        []ocmclusterv1.ClientConfig
+}
+
+// ProvisionManagedCluster creates or updates the accepted ManagedCluster before the spoke-cluster joins,
+// so that its identity and policy are set by the hub-cluster
+func (c *Cluster) ProvisionManagedCluster(ctx context.Context, clusterName string, accept AcceptOptions, provision ProvisionOptions) error {
+	var mc, previous *ocmclusterv1.ManagedCluster
+	exist, changed := false, false
+	// the ManagedCluster may be created or updated by the agent concurrently
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return kerrors.IsConflict(err) || kerrors.IsAlreadyExists(err)
+	}, func() error {
+		mc = new(ocmclusterv1.ManagedCluster)
+		err := c.Client.Get(ctx, client.ObjectKey{Name: clusterName}, mc)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+		exist = err == nil
+
+		previous = mc.DeepCopy()
+		mc.Name = clusterName
+		mc.Spec.HubAcceptsClient = true
+		if provision.LeaseDurationSeconds != 0 {
+			mc.Spec.LeaseDurationSeconds = provision.LeaseDurationSeconds
+		}
+		if len(provision.ClientConfigs) != 0 {
+			mc.Spec.ManagedClusterClientConfigs = provision.ClientConfigs
+		}
+		accept.apply(mc)
+
+		if !exist {
+			changed = true
+			klog.InfoS("provision managed cluster", "name", clusterName)
+			return c.Client.Create(ctx, mc)
+		}
+		if changed = !equality.Semantic.DeepEqual(previous, mc); !changed {
+			return nil
+		}
+		klog.InfoS("update provisioned managed cluster", "name", clusterName)
+		return c.Client.Update(ctx, mc)
+	})
+	if err != nil || !changed || c.DryRun {
+		return err
+	}
+	if !exist {
+		c.Tracker.RecordTyped(c.KubeConfig.Host, c.Client, mc, nil)
+	} else {
+		c.Tracker.RecordTyped(c.KubeConfig.Host, c.Client, mc, previous)
+	}
+	return nil
+}
+
+// WaitForSpokeClusterCSR waits for the csr of spoke-cluster, the ManagedCluster is provisioned by the hub-cluster
+func (c *Cluster) WaitForSpokeClusterCSR(ctx context.Context, clusterName string) error {
+	csrList := new(certificatesv1.CertificateSigningRequestList)
+	startTime := time.Now()
+	return wait.PollUntilContextTimeout(ctx, 10*time.Second, 10*time.Minute, true, func(ctx context.Context) (done bool, err error) {
+		klog.V(common.LogDebug).InfoS("Waiting for register request", "waitTime", time.Since(startTime))
+		err = c.Client.List(ctx, csrList, client.MatchingLabels{clusterLabel: clusterName})
+		if err != nil {
+			klog.V(common.LogDebug).InfoS("Fail to get CertificateSigningRequestList")
+			return false, nil
+		}
+		return len(csrList.Items) > 0, nil
+	})
+}
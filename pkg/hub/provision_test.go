@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+// conflictingCluster returns a hub-cluster whose client fails the first create and update of ManagedCluster,
+// as if the agent changed it concurrently
+func conflictingCluster(objects ...client.Object) *Cluster {
+	gr := schema.GroupResource{Group: ocmclusterv1.GroupName, Resource: "managedclusters"}
+	created, updated := false, false
+	k8sClient := fake.NewClientBuilder().WithScheme(common.Scheme).WithObjects(objects...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if !created {
+					created = true
+					// the agent creates the ManagedCluster first
+					mc := &ocmclusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: obj.GetName()}}
+					if err := c.Create(ctx, mc); err != nil {
+						return err
+					}
+					return kerrors.NewAlreadyExists(gr, obj.GetName())
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				if !updated {
+					updated = true
+					return kerrors.NewConflict(gr, obj.GetName(), nil)
+				}
+				return c.Update(ctx, obj, opts...)
+			},
+		}).Build()
+	return &Cluster{Args: common.Args{Client: k8sClient, KubeConfig: &rest.Config{Host: "hub"}, Tracker: common.NewTracker()}}
+}
+
+func TestAcceptSpokeClusterRetriesOnConflict(t *testing.T) {
+	ctx := context.Background()
+	c := conflictingCluster(&ocmclusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+	if err := c.AcceptSpokeCluster(ctx, "a", AcceptOptions{Labels: map[string]string{"env": "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	mc, err := c.GetManagedCluster(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mc.Spec.HubAcceptsClient || mc.Labels["env"] != "prod" {
+		t.Errorf("expect the managed cluster to be accepted with the labels, got %+v", mc)
+	}
+	if objects := c.Tracker.Objects(); len(objects) != 1 || objects[0].Action != common.ActionUpdated {
+		t.Errorf("expect the update to be tracked, got %+v", objects)
+	}
+}
+
+func TestProvisionManagedClusterRetriesOnConflict(t *testing.T) {
+	ctx := context.Background()
+	c := conflictingCluster()
+	if err := c.ProvisionManagedCluster(ctx, "a", AcceptOptions{}, ProvisionOptions{LeaseDurationSeconds: 120}); err != nil {
+		t.Fatal(err)
+	}
+	mc, err := c.GetManagedCluster(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mc.Spec.HubAcceptsClient || mc.Spec.LeaseDurationSeconds != 120 {
+		t.Errorf("expect the managed cluster to be provisioned, got %+v", mc.Spec)
+	}
+	// the ManagedCluster created by the agent is updated, which is rolled back by restoring it
+	if objects := c.Tracker.Objects(); len(objects) != 1 || objects[0].Action != common.ActionUpdated {
+		t.Errorf("expect the update to be tracked, got %+v", objects)
+	}
+}
@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReportAnnotation is the annotation of the cluster secret recording the report of the last registration
+const ReportAnnotation = "cluster-register.oam.dev/report"
+
+// SaveReportToConfigMap writes the report of cluster to the <cluster>.json key of a ConfigMap, which is created
+// if it doesn't exist. The reports aren't tracked, they are kept even if the registration is rolled back.
+func (c *Cluster) SaveReportToConfigMap(ctx context.Context, namespace, name, clusterName string, report []byte) error {
+	key := clusterName + ".json"
+	cm := new(corev1.ConfigMap)
+	err := c.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm)
+	if kerrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{key: string(report)},
+		}
+		return c.Client.Create(ctx, cm)
+	}
+	if err != nil {
+		return err
+	}
+	patched := cm.DeepCopy()
+	if patched.Data == nil {
+		patched.Data = map[string]string{}
+	}
+	patched.Data[key] = string(report)
+	return c.Client.Patch(ctx, patched, client.MergeFrom(cm))
+}
+
+// SaveReportToSecret records the report in the ReportAnnotation of a Secret, i.e. the secret the spoke-cluster
+// credential is read from
+func (c *Cluster) SaveReportToSecret(ctx context.Context, namespace, name string, report []byte) error {
+	secret := new(corev1.Secret)
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return err
+	}
+	patched := secret.DeepCopy()
+	metav1.SetMetaDataAnnotation(&patched.ObjectMeta, ReportAnnotation, string(report))
+	return c.Client.Patch(ctx, patched, client.MergeFrom(secret))
+}
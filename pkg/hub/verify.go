@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	ocmworkv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	// smokeTestName is the name of the ManifestWork and the scratch namespace on spoke-cluster of the smoke test
+	smokeTestName = "cluster-register-smoke-test"
+	// smokeTestFeedback is the status feedback of the scratch namespace, which must be Active
+	smokeTestFeedback = "phase"
+)
+
+// VerifyResult is the time each leg of the smoke test took to complete since the ManifestWork was created
+type VerifyResult struct {
+	Applied   time.Duration `json:"applied"`
+	Available time.Duration `json:"available"`
+	Feedback  time.Duration `json:"feedback"`
+}
+
+// VerifyManifestWork deploys a scratch namespace and ConfigMap to the managed cluster through a ManifestWork,
+// and waits for it to be applied, available and to report the status of the namespace back.
+// The ManifestWork is deleted afterwards, whether the verification succeeds or not.
+func (c *Cluster) VerifyManifestWork(ctx context.Context, clusterName string, timeout time.Duration) (*VerifyResult, error) {
+	work := renderSmokeTestWork(clusterName)
+	err := c.Client.Create(ctx, work)
+	if kerrors.IsAlreadyExists(err) {
+		// left by an interrupted run
+		if err = c.deleteSmokeTestWork(ctx, work, timeout); err != nil {
+			return nil, err
+		}
+		err = c.Client.Create(ctx, work)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to create ManifestWork %s: %w", smokeTestName, err)
+	}
+	startTime := time.Now()
+	defer func() {
+		klog.InfoS("delete smoke test ManifestWork", "object", klog.KObj(work))
+		if err := client.IgnoreNotFound(c.Client.Delete(context.Background(), work)); err != nil {
+			klog.InfoS("Fail to delete smoke test ManifestWork", "object", klog.KObj(work), "err", err)
+		}
+	}()
+
+	result := &VerifyResult{}
+	legs := []struct {
+		name     string
+		done     func(*ocmworkv1.ManifestWork) bool
+		duration *time.Duration
+	}{
+		{name: ocmworkv1.WorkApplied, done: workConditionTrue(ocmworkv1.WorkApplied), duration: &result.Applied},
+		{name: ocmworkv1.WorkAvailable, done: workConditionTrue(ocmworkv1.WorkAvailable), duration: &result.Available},
+		{name: "status feedback", done: namespaceFeedbackActive, duration: &result.Feedback},
+	}
+	deadline := startTime.Add(timeout)
+	for _, leg := range legs {
+		current := new(ocmworkv1.ManifestWork)
+		err = wait.PollUntilContextTimeout(ctx, 2*time.Second, time.Until(deadline), true, func(ctx context.Context) (bool, error) {
+			if err := c.Client.Get(ctx, client.ObjectKeyFromObject(work), current); err != nil {
+				klog.V(common.LogDebug).InfoS("Fail to get smoke test ManifestWork", "err", err)
+				return false, nil
+			}
+			return leg.done(current), nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("ManifestWork %s/%s isn't %s after %s: %s", clusterName, smokeTestName, leg.name,
+				time.Since(startTime).Round(time.Second), describeWorkConditions(current))
+		}
+		*leg.duration = time.Since(startTime)
+		klog.InfoS("smoke test passed", "leg", leg.name, "duration", leg.duration.Round(time.Millisecond))
+	}
+	return result, nil
+}
+
+func (c *Cluster) deleteSmokeTestWork(ctx context.Context, work *ocmworkv1.ManifestWork, timeout time.Duration) error {
+	klog.InfoS("delete stale smoke test ManifestWork", "object", klog.KObj(work))
+	if err := client.IgnoreNotFound(c.Client.Delete(ctx, work)); err != nil {
+		return err
+	}
+	return wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		err := c.Client.Get(ctx, client.ObjectKeyFromObject(work), new(ocmworkv1.ManifestWork))
+		return kerrors.IsNotFound(err), nil
+	})
+}
+
+func renderSmokeTestWork(clusterName string) *ocmworkv1.ManifestWork {
+	namespace := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: smokeTestName},
+	}
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: smokeTestName, Namespace: smokeTestName},
+		Data:       map[string]string{"cluster": clusterName},
+	}
+	return &ocmworkv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Name: smokeTestName, Namespace: clusterName},
+		Spec: ocmworkv1.ManifestWorkSpec{
+			Workload: ocmworkv1.ManifestsTemplate{Manifests: []ocmworkv1.Manifest{
+				{RawExtension: runtime.RawExtension{Object: namespace}},
+				{RawExtension: runtime.RawExtension{Object: configMap}},
+			}},
+			ManifestConfigs: []ocmworkv1.ManifestConfigOption{{
+				ResourceIdentifier: ocmworkv1.ResourceIdentifier{Resource: "namespaces", Name: smokeTestName},
+				FeedbackRules: []ocmworkv1.FeedbackRule{{
+					Type:      ocmworkv1.JSONPathsType,
+					JsonPaths: []ocmworkv1.JsonPath{{Name: smokeTestFeedback, Path: ".phase"}},
+				}},
+			}},
+		},
+	}
+}
+
+func workConditionTrue(conditionType string) func(*ocmworkv1.ManifestWork) bool {
+	return func(work *ocmworkv1.ManifestWork) bool {
+		return meta.IsStatusConditionTrue(work.Status.Conditions, conditionType)
+	}
+}
+
+func namespaceFeedbackActive(work *ocmworkv1.ManifestWork) bool {
+	for _, manifest := range work.Status.ResourceStatus.Manifests {
+		if manifest.ResourceMeta.Resource != "namespaces" {
+			continue
+		}
+		for _, value := range manifest.StatusFeedbacks.Values {
+			if value.Name == smokeTestFeedback && value.Value.String != nil {
+				return *value.Value.String == string(corev1.NamespaceActive)
+			}
+		}
+	}
+	return false
+}
+
+func describeWorkConditions(work *ocmworkv1.ManifestWork) string {
+	if len(work.Status.Conditions) == 0 {
+		return "no condition reported by the work agent"
+	}
+	var res string
+	for i, cond := range work.Status.Conditions {
+		if i > 0 {
+			res += "; "
+		}
+		res += fmt.Sprintf("%s=%s (%s: %s)", cond.Type, cond.Status, cond.Reason, cond.Message)
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const namespace = "cluster_register"
+
+var (
+	// Registry has the metrics of cluster-register, it is served on /metrics or pushed to a Pushgateway
+	Registry = prometheus.NewRegistry()
+
+	// RegistrationAttempts counts the runs of registration
+	RegistrationAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registration_attempts_total",
+		Help:      "Number of registration attempts.",
+	})
+	// Registrations counts the outcomes of registration, the phase and reason are empty if succeeded
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Number of registrations by result, and by the failed phase and reason of failures.",
+	}, []string{"result", "phase", "reason"})
+	// PhaseDuration observes the duration of the phases run by registrations
+	PhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of registration phases by phase and result.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"phase", "result"})
+	// CSRs counts the csr approved or found denied
+	CSRs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "csrs_total",
+		Help:      "Number of csr of spoke-clusters approved or found denied.",
+	}, []string{"decision"})
+	// CSRApprovalLatency observes the time from the creation of a csr to its approval
+	CSRApprovalLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "csr_approval_latency_seconds",
+		Help:      "Time from the creation of a csr to its approval.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		RegistrationAttempts,
+		Registrations,
+		PhaseDuration,
+		CSRs,
+		CSRApprovalLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveRegistration records the outcome of a registration, phase is the failed phase if err isn't nil
+func ObserveRegistration(phase string, err error) {
+	if err == nil {
+		Registrations.WithLabelValues("succeeded", "", "").Inc()
+		return
+	}
+	Registrations.WithLabelValues("failed", phase, Reason(err)).Inc()
+}
+
+// Reason is a short and bounded classification of err for the label of metrics
+func Reason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "Timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "Canceled"
+	}
+	if reason := kerrors.ReasonForError(err); len(reason) != 0 {
+		return string(reason)
+	}
+	return "Error"
+}
+
+// ManagedClusterLister lists the ManagedClusters of hub-cluster
+type ManagedClusterLister func(ctx context.Context) ([]ocmclusterv1.ManagedCluster, error)
+
+// managedClusterCollector reports the number of ManagedClusters by availability when it is scraped
+type managedClusterCollector struct {
+	list ManagedClusterLister
+	desc *prometheus.Desc
+}
+
+// RegisterManagedClusters adds the gauge of ManagedClusters by availability, which lists them on every scrape
+func RegisterManagedClusters(list ManagedClusterLister) error {
+	return Registry.Register(&managedClusterCollector{
+		list: list,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "managed_clusters"),
+			"Number of managed clusters by the status of the Available condition.", []string{"available"}, nil),
+	})
+}
+
+func (c *managedClusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *managedClusterCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	clusters, err := c.list(ctx)
+	if err != nil {
+		klog.InfoS("Fail to list managed clusters for metrics", "err", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	counts := map[string]int{"True": 0, "False": 0, "Unknown": 0}
+	for _, mc := range clusters {
+		status := "Unknown"
+		if cond := meta.FindStatusCondition(mc.Status.Conditions, ocmclusterv1.ManagedClusterConditionAvailable); cond != nil {
+			status = string(cond.Status)
+		}
+		counts[status]++
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"k8s.io/klog/v2"
+)
+
+// Serve serves the metrics on /metrics of addr until ctx is done
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	klog.InfoS("serve metrics", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Push pushes the metrics to a Pushgateway compatible endpoint, grouped by the job and cluster.
+// The metrics of the previous push with the same grouping are replaced.
+func Push(url, job, cluster string) error {
+	pusher := push.New(url, job).Gatherer(Registry)
+	if len(cluster) != 0 {
+		pusher = pusher.Grouping("cluster", cluster)
+	}
+	return pusher.Push()
+}
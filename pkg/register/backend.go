@@ -0,0 +1,72 @@
+package register
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+const (
+	// BackendOCM registers the spoke-cluster as an OCM ManagedCluster
+	BackendOCM = "ocm"
+	// BackendClusterGateway registers the spoke-cluster as a cluster secret of KubeVela cluster-gateway
+	BackendClusterGateway = "cluster-gateway"
+)
+
+// Backend registers a spoke-cluster to the hub-cluster with one multi-cluster mechanism
+type Backend interface {
+	// Run registers the spoke-cluster
+	Run(ctx context.Context) error
+	// Result returns the outcome of Run, it is available even if Run fails
+	Result() *Result
+}
+
+// Result is the outcome of a registration
+type Result struct {
+	// Tracker records the objects changed by the registration
+	Tracker *common.Tracker
+	// AddonStatus is the health of the add-ons enabled by the registration
+	AddonStatus []hub.AddonStatus
+	// VerifyResult is the timing of the smoke test if verified
+	VerifyResult *hub.VerifyResult
+	// UID is the uid of the ManagedCluster if it exists
+	UID types.UID
+	// Phases are the outcome of the phases in the order they are run
+	Phases []PhaseResult
+	// ApprovedCSRs are the names of the approved csr of the spoke-cluster
+	ApprovedCSRs []string
+	// AgentImages are the images of the agents on the spoke-cluster
+	AgentImages map[string]string
+	// Warnings are the problems which don't fail the registration
+	Warnings []string
+}
+
+// NewBackend creates the registration of the backend name
+func NewBackend(name string, hubCluster *hub.Cluster, opts Options) (Backend, error) {
+	switch name {
+	case BackendOCM, "":
+		return NewRegistration(hubCluster, opts), nil
+	case BackendClusterGateway:
+		return NewGatewayRegistration(hubCluster, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown registration backend %s", name)
+	}
+}
+
+// Result returns the outcome of the registration
+func (r *Registration) Result() *Result {
+	return &Result{
+		Tracker:      r.Tracker,
+		AddonStatus:  r.AddonStatus,
+		VerifyResult: r.VerifyResult,
+		UID:          r.UID,
+		Phases:       r.Phases,
+		ApprovedCSRs: r.ApprovedCSRs,
+		AgentImages:  r.AgentImages,
+		Warnings:     r.Warnings,
+	}
+}
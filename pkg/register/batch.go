@@ -0,0 +1,73 @@
+package register
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+// BatchResult is the outcome of one registration of a batch
+type BatchResult struct {
+	Cluster   string        `json:"cluster"`
+	Succeeded bool          `json:"succeeded"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"-"`
+	// Result is the outcome of the registration, it is nil if the registration isn't started
+	Result *Result `json:"-"`
+}
+
+// RunBatch registers the spoke-clusters with at most workers registrations at a time, each one bounded by timeout.
+// The registrations share the client of hubCluster, and the results are in the order of items.
+func RunBatch(ctx context.Context, hubCluster *hub.Cluster, items []Options, workers int, timeout time.Duration) []BatchResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]BatchResult, len(items))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = runBatchItem(ctx, hubCluster, items[i], timeout)
+			}
+		}()
+	}
+	for i := range items {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// runBatchItem registers one spoke-cluster within timeout, a registration rolled back on failure isn't cut short by it
+func runBatchItem(ctx context.Context, hubCluster *hub.Cluster, opts Options, timeout time.Duration) BatchResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// every registration records its own changes, the client is shared
+	hubCopy := *hubCluster
+	registration := NewRegistration(&hubCopy, opts)
+	startTime := time.Now()
+	klog.InfoS("start registration", "name", opts.ClusterName)
+	err := registration.Run(ctx)
+	result := BatchResult{
+		Cluster:   opts.ClusterName,
+		Succeeded: err == nil,
+		Duration:  time.Since(startTime),
+		Result:    registration.Result(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		klog.InfoS("Fail to register spoke cluster", "name", opts.ClusterName, "err", err)
+	} else {
+		klog.InfoS("successfully register cluster", "name", opts.ClusterName, "duration", result.Duration.Round(time.Second))
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package register
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/gateway"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/metrics"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// GatewayRegistration registers a spoke-cluster as a cluster secret of KubeVela cluster-gateway.
+// A service account is created on the spoke-cluster, and its credential is written to the hub-cluster.
+type GatewayRegistration struct {
+	Options
+	Hub   *hub.Cluster
+	Spoke *gateway.Cluster
+	// Tracker records the objects changed by this run
+	Tracker *common.Tracker
+}
+
+// NewGatewayRegistration creates a cluster-gateway registration with the hub-cluster client
+func NewGatewayRegistration(hubCluster *hub.Cluster, opts Options) *GatewayRegistration {
+	tracker := common.NewTracker()
+	hubCluster.Tracker = tracker
+	return &GatewayRegistration{Options: opts, Hub: hubCluster, Tracker: tracker}
+}
+
+// Run issues the credential on the spoke-cluster and writes the cluster secret to the hub-cluster
+func (g *GatewayRegistration) Run(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "register", attribute.String("cluster", g.ClusterName), attribute.String("backend", BackendClusterGateway))
+	defer func() { tracing.End(span, err) }()
+
+	metrics.RegistrationAttempts.Inc()
+	err = g.run(ctx)
+	metrics.ObserveRegistration("", err)
+	return err
+}
+
+func (g *GatewayRegistration) run(ctx context.Context) error {
+	if errs := validation.IsDNS1123Subdomain(g.ClusterName); len(errs) != 0 {
+		return fmt.Errorf("invalid cluster name %q: %s", g.ClusterName, strings.Join(errs, ", "))
+	}
+	if g.SpokeConfig == nil {
+		return fmt.Errorf("the kubeconfig of spoke-cluster is required")
+	}
+	caData := g.SpokeConfig.CAData
+	if len(caData) == 0 && len(g.SpokeConfig.CAFile) != 0 {
+		data, err := os.ReadFile(g.SpokeConfig.CAFile)
+		if err != nil {
+			return err
+		}
+		caData = data
+	}
+
+	var err error
+	g.Spoke, err = gateway.NewSpokeCluster(g.ClusterName, g.SpokeConfig)
+	if err != nil {
+		return err
+	}
+	g.Spoke.Args.Overrides = g.Overrides
+	g.Spoke.Args.Tracker = g.Tracker
+	g.Spoke.ClusterRole = g.GatewayClusterRole
+	if g.DryRun {
+		g.Spoke.Args.EnableDryRun()
+	}
+
+	credentialType := g.CredentialType
+	if len(credentialType) == 0 {
+		credentialType = gateway.CredentialTypeServiceAccountToken
+	}
+	klog.InfoS("issue credential of cluster-gateway", tracing.LogValues(ctx, "name", g.ClusterName, "type", credentialType)...)
+	cred, err := g.Spoke.IssueCredential(ctx, credentialType)
+	if err != nil {
+		return g.rollback(ctx, fmt.Errorf("fail to issue credential: %w", err))
+	}
+
+	secret, err := gateway.RenderClusterSecret(g.ClusterName, g.SpokeConfig.Host, caData, cred, g.Accept.Labels, g.Accept.Annotations)
+	if err != nil {
+		return g.rollback(ctx, err)
+	}
+	klog.InfoS("write cluster secret of cluster-gateway", tracing.LogValues(ctx, "object", klog.KObj(secret))...)
+	if err = g.Hub.ApplyObjects(ctx, []*unstructured.Unstructured{secret}); err != nil {
+		return g.rollback(ctx, fmt.Errorf("fail to write cluster secret: %w", err))
+	}
+	return nil
+}
+
+// rollback undoes the changes of this run if RollbackOnFailure, the error is returned anyway
+func (g *GatewayRegistration) rollback(ctx context.Context, runErr error) error {
+	if !g.RollbackOnFailure || g.DryRun {
+		return runErr
+	}
+	ctx, cancel := rollbackContext(ctx)
+	defer cancel()
+	klog.InfoS("roll back the registration", tracing.LogValues(ctx, "name", g.ClusterName, "objects", len(g.Tracker.Objects()))...)
+	if err := g.Tracker.Rollback(ctx); err != nil {
+		return fmt.Errorf("%w, and fail to roll back: %v", runErr, err)
+	}
+	return runErr
+}
+
+// Result returns the outcome of the registration
+func (g *GatewayRegistration) Result() *Result {
+	return &Result{Tracker: g.Tracker}
+}
@@ -0,0 +1,106 @@
+package register
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+// MigrateOptions are the inputs of migrating a registered spoke-cluster to another hub-cluster or name
+type MigrateOptions struct {
+	// Options registers the spoke-cluster to the target hub-cluster, ClusterName is the new name
+	Options
+	// SourceName is the name of the ManagedCluster on the source hub-cluster
+	SourceName string
+}
+
+// Migrate registers the spoke-cluster of a ManagedCluster on source to target, with the labels and taints copied.
+// Across hub-clusters, the ManagedClusterSet and its bindings are created on target as well.
+// The ManagedCluster is deleted from source only after the spoke-cluster is available on target.
+// If source and target are the same hub-cluster, the ManagedCluster is renamed.
+func Migrate(ctx context.Context, source, target *hub.Cluster, opts MigrateOptions) error {
+	sameHub := source == target
+	if sameHub && opts.SourceName == opts.ClusterName {
+		return fmt.Errorf("nothing to migrate, the target is the same as the source")
+	}
+
+	mc, err := source.GetManagedCluster(ctx, opts.SourceName)
+	if err != nil {
+		return fmt.Errorf("fail to get managed cluster %s from source hub: %w", opts.SourceName, err)
+	}
+
+	// copy the labels, taints and cluster set membership, which is a label, before the explicit ones
+	labels := copyableLabels(mc.Labels)
+	for k, v := range opts.Accept.Labels {
+		labels[k] = v
+	}
+	opts.Accept.Labels = labels
+	opts.Accept.Taints = append(copyableTaints(mc.Spec.Taints), opts.Accept.Taints...)
+	if len(opts.ClusterSet) == 0 && !sameHub {
+		// the cluster set and its bindings may not exist on the target hub-cluster yet
+		opts.ClusterSet = mc.Labels[ocmclusterv1beta2.ClusterSetLabel]
+		if len(opts.ClusterSet) != 0 {
+			namespaces, err := source.ListManagedClusterSetBindingNamespaces(ctx, opts.ClusterSet)
+			if err != nil {
+				return fmt.Errorf("fail to list bindings of managed cluster set %s on source hub: %w", opts.ClusterSet, err)
+			}
+			opts.ClusterSetBindings = sets.NewString(namespaces...).Insert(opts.ClusterSetBindings...).List()
+		}
+	}
+
+	// the agents have to bootstrap with the target hub-cluster or the new name
+	opts.Takeover = true
+	opts.Rebootstrap = true
+	if sameHub {
+		opts.RenamedFrom = opts.SourceName
+	}
+
+	klog.InfoS("migrate managed cluster", "from", opts.SourceName, "to", opts.ClusterName, "sameHub", sameHub)
+	if err = NewRegistration(target, opts.Options).Run(ctx); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	// the registration may stop before the spoke-cluster is available, e.g. with Until
+	mc, err = target.GetManagedCluster(ctx, opts.ClusterName)
+	if err != nil {
+		return fmt.Errorf("fail to get managed cluster %s from target hub: %w", opts.ClusterName, err)
+	}
+	if !meta.IsStatusConditionTrue(mc.Status.Conditions, ocmclusterv1.ManagedClusterConditionAvailable) {
+		return fmt.Errorf("managed cluster %s isn't available on target hub, %s is kept on source hub", opts.ClusterName, opts.SourceName)
+	}
+	return source.DeleteManagedCluster(ctx, opts.SourceName)
+}
+
+// copyableLabels filters out the labels maintained by the hub-cluster and agents
+func copyableLabels(labels map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range labels {
+		if k == "name" || strings.HasPrefix(k, "feature.open-cluster-management.io/") {
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// copyableTaints filters out the taints maintained by the hub-cluster
+func copyableTaints(taints []ocmclusterv1.Taint) []ocmclusterv1.Taint {
+	var res []ocmclusterv1.Taint
+	for _, t := range taints {
+		if t.Key == ocmclusterv1.ManagedClusterTaintUnavailable || t.Key == ocmclusterv1.ManagedClusterTaintUnreachable {
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
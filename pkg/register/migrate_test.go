@@ -0,0 +1,50 @@
+package register
+
+import (
+	"reflect"
+	"testing"
+
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func TestCopyableLabels(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{name: "no labels", labels: nil, want: map[string]string{}},
+		{
+			name: "labels maintained by hub-cluster are dropped",
+			labels: map[string]string{
+				"name": "a",
+				"feature.open-cluster-management.io/addon-cluster-proxy": "available",
+				"env": "prod",
+				"cluster.open-cluster-management.io/clusterset": "prod",
+			},
+			want: map[string]string{"env": "prod", "cluster.open-cluster-management.io/clusterset": "prod"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := copyableLabels(c.labels); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestCopyableTaints(t *testing.T) {
+	gpu := ocmclusterv1.Taint{Key: "gpu", Value: "true", Effect: ocmclusterv1.TaintEffectNoSelect}
+	taints := []ocmclusterv1.Taint{
+		{Key: ocmclusterv1.ManagedClusterTaintUnavailable, Effect: ocmclusterv1.TaintEffectNoSelect},
+		gpu,
+		{Key: ocmclusterv1.ManagedClusterTaintUnreachable, Effect: ocmclusterv1.TaintEffectNoSelect},
+	}
+	if got, want := copyableTaints(taints), []ocmclusterv1.Taint{gpu}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expect %v, got %v", want, got)
+	}
+	if got := copyableTaints(taints[:1]); len(got) != 0 {
+		t.Errorf("expect no taint, got %v", got)
+	}
+}
@@ -0,0 +1,707 @@
+package register
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog/v2"
+	ocmclusterv1 "open-cluster-management.io/api/cluster/v1"
+	ocmclusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/metrics"
+	"github.com/oam-dev/cluster-register/pkg/spoke"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// Phase is a named step of registration
+type Phase string
+
+const (
+	PhaseValidate      Phase = "validate"
+	PhaseClusterSet    Phase = "cluster-set"
+	PhasePreProvision  Phase = "pre-provision"
+	PhaseHubToken      Phase = "hub-token"
+	PhaseSpokeEnv      Phase = "spoke-env"
+	PhaseWaitCSR       Phase = "wait-csr"
+	PhaseApprove       Phase = "approve"
+	PhaseAccept        Phase = "accept"
+	PhaseWaitAvailable Phase = "wait-available"
+	PhaseVerify        Phase = "verify"
+	PhaseBaseline      Phase = "baseline"
+	PhaseAddons        Phase = "addons"
+)
+
+// phaseEvent is the Normal event emitted when a phase succeeds
+type phaseEvent struct {
+	reason  string
+	message string
+}
+
+var phaseEvents = map[Phase]phaseEvent{
+	PhaseHubToken:      {"TokenIssued", "bootstrap token for spoke-cluster is issued"},
+	PhaseSpokeEnv:      {"SpokeEnvApplied", "klusterlet and bootstrap kubeconfig are applied to spoke-cluster"},
+	PhaseWaitCSR:       {"CSRSeen", "register request of spoke-cluster is seen"},
+	PhaseAccept:        {"Accepted", "managed cluster is accepted"},
+	PhaseWaitAvailable: {"Available", "managed cluster is available"},
+}
+
+// verifyTimeout is how long the smoke test ManifestWork is waited for
+const verifyTimeout = 5 * time.Minute
+
+// baselineTimeout is how long the baseline ManifestWorks are waited for to be applied
+const baselineTimeout = 5 * time.Minute
+
+// addonTimeout is how long the add-ons are waited for to be available
+const addonTimeout = 5 * time.Minute
+
+// rollbackTimeout is how long the rollback may take, it isn't bounded by the timeout of the failed registration
+const rollbackTimeout = 5 * time.Minute
+
+// tokenReuseMargin is the minimal remaining lifetime of a bootstrap token to be reused by a rerun
+const tokenReuseMargin = 10 * time.Minute
+
+// Options are the inputs of a registration
+type Options struct {
+	ClusterName  string
+	HubAPIServer string
+	SpokeConfig  *rest.Config
+	Overrides    *common.Overrides
+	// DryRun sends every write request as a server-side dry-run, no token is minted and no csr is approved
+	DryRun bool
+	// Restart ignores the phases completed by previous runs
+	Restart bool
+	// Until stops the registration after the phase, all phases are run if empty
+	Until Phase
+	// RollbackOnFailure deletes the objects created and restores the objects updated by this run if it fails
+	RollbackOnFailure bool
+	// Takeover registers a spoke-cluster which is joined to another hub-cluster, its agents re-bootstrap with this hub
+	Takeover bool
+	// Rebootstrap makes the agents bootstrap again even if they are joined to this hub-cluster, e.g. to be renamed
+	Rebootstrap bool
+	// RenamedFrom is the name of the ManagedCluster on this hub-cluster being renamed to ClusterName
+	RenamedFrom string
+	// Accept is applied to the ManagedCluster together with accepting it
+	Accept hub.AcceptOptions
+	// PreProvision creates the accepted ManagedCluster before the spoke-cluster joins
+	PreProvision bool
+	// LeaseDurationSeconds of the pre-provisioned ManagedCluster, the default of hub-cluster is used if zero
+	LeaseDurationSeconds int32
+	// ClusterSet joins the ManagedCluster to the ManagedClusterSet, which is created if it doesn't exist
+	ClusterSet string
+	// ClusterSetBindings are the namespaces the ManagedClusterSet is bound to
+	ClusterSetBindings []string
+	// Claims are created as ClusterClaims on the spoke-cluster besides the generated ones
+	Claims map[string]string
+	// Addons are enabled on the ManagedCluster once it is available
+	Addons []hub.Addon
+	// Verify deploys a smoke test ManifestWork to the ManagedCluster once it is available
+	Verify bool
+	// Baseline are the manifests delivered to the ManagedCluster through ManifestWorks once it is available,
+	// keyed by file name
+	Baseline map[string][]byte
+	// WaitBaseline waits for the baseline ManifestWorks to be applied
+	WaitBaseline bool
+	// HubKubeConfig is the bootstrap kubeconfig shared by a batch of registrations, a token is minted if it is nil
+	// or its token expires soon
+	HubKubeConfig *clientcmdapiv1.Config
+	// CredentialType is how cluster-gateway authenticates to the spoke-cluster, ServiceAccountToken if empty.
+	// It is only used by the cluster-gateway backend.
+	CredentialType string
+	// GatewayClusterRole is bound to cluster-gateway on the spoke-cluster, the embedded least-privilege ClusterRole
+	// if empty. It is only used by the cluster-gateway backend.
+	GatewayClusterRole string
+}
+
+// Registration registers a spoke-cluster to the hub-cluster in phases.
+// The completed phases are recorded in a checkpoint on hub-cluster, and skipped by the next run
+// until the registration succeeds.
+type Registration struct {
+	Options
+	Hub   *hub.Cluster
+	Spoke *spoke.Cluster
+	// Tracker records the objects changed by this run
+	Tracker *common.Tracker
+	// AddonStatus is the health of the Addons after the registration
+	AddonStatus []hub.AddonStatus
+	// VerifyResult is the timing of the smoke test if Verify
+	VerifyResult *hub.VerifyResult
+	// Phases are the outcome of the phases in the order they are run
+	Phases []PhaseResult
+	// ApprovedCSRs are the names of the approved csr of the spoke-cluster
+	ApprovedCSRs []string
+	// Warnings are the problems which don't fail the registration
+	Warnings []string
+	// UID is the uid of the ManagedCluster
+	UID types.UID
+	// AgentImages are the images of the klusterlet agents on spoke-cluster, keyed by deployment name
+	AgentImages map[string]string
+
+	checkpoint *hub.Checkpoint
+	stopped    bool
+	// hubEndpoint is the hub-cluster the spoke-cluster is registered to
+	hubEndpoint spoke.HubEndpoint
+	// takeover is set if the spoke-cluster is joined to another hub-cluster and Takeover
+	takeover bool
+	// fingerprint identifies the physical spoke-cluster
+	fingerprint string
+}
+
+type phase struct {
+	name Phase
+	run  func(ctx context.Context) error
+	// resume restores the state a completed phase passes to the following phases,
+	// the phase is run again if resume fails
+	resume func(ctx context.Context) error
+}
+
+// NewRegistration creates a registration with the hub-cluster client
+func NewRegistration(hubCluster *hub.Cluster, opts Options) *Registration {
+	tracker := common.NewTracker()
+	hubCluster.Tracker = tracker
+	return &Registration{Options: opts, Hub: hubCluster, Tracker: tracker}
+}
+
+func (r *Registration) phases() []phase {
+	return []phase{
+		{name: PhaseValidate, run: r.validate},
+		{name: PhaseClusterSet, run: r.ensureClusterSet},
+		{name: PhasePreProvision, run: r.preProvision},
+		{name: PhaseHubToken, run: r.generateHubKubeConfig, resume: r.reuseHubKubeConfig},
+		{name: PhaseSpokeEnv, run: r.initSpokeEnv},
+		{name: PhaseWaitCSR, run: r.waitForCSR},
+		{name: PhaseApprove, run: r.approve},
+		{name: PhaseAccept, run: r.accept},
+		{name: PhaseWaitAvailable, run: r.waitForAvailable},
+		{name: PhaseVerify, run: r.verify},
+		{name: PhaseBaseline, run: r.applyBaseline},
+		{name: PhaseAddons, run: r.enableAddons},
+	}
+}
+
+// Run runs all the phases which aren't completed by previous runs
+func (r *Registration) Run(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "register", attribute.String("cluster", r.ClusterName), attribute.Bool("dryRun", r.DryRun))
+	defer func() { tracing.End(span, err) }()
+	klog.InfoS("start registration", tracing.LogValues(ctx, "name", r.ClusterName)...)
+
+	metrics.RegistrationAttempts.Inc()
+	err = r.run(ctx)
+	r.collectResult(ctx)
+	failed := ""
+	if n := len(r.Phases); err != nil && n != 0 && r.Phases[n-1].State == PhaseFailed {
+		failed = string(r.Phases[n-1].Name)
+	}
+	metrics.ObserveRegistration(failed, err)
+	return err
+}
+
+func (r *Registration) run(ctx context.Context) error {
+	if err := r.loadCheckpoint(ctx); err != nil {
+		return err
+	}
+
+	for _, p := range r.phases() {
+		if r.stopped {
+			return nil
+		}
+		start := time.Now()
+		if r.completed(p) {
+			if p.resume == nil {
+				klog.InfoS("skip phase completed by previous run", tracing.LogValues(ctx, "phase", p.name, "name", r.ClusterName)...)
+				r.Phases = append(r.Phases, PhaseResult{Name: p.name, State: PhaseSkipped})
+				continue
+			}
+			err := p.resume(ctx)
+			if err == nil {
+				klog.InfoS("resume phase completed by previous run", tracing.LogValues(ctx, "phase", p.name, "name", r.ClusterName)...)
+				r.Phases = append(r.Phases, PhaseResult{Name: p.name, State: PhaseResumed, Duration: time.Since(start)})
+				continue
+			}
+			r.warn("fail to resume phase %s, run it again: %v", p.name, err)
+		}
+
+		phaseCtx, span := tracing.Start(ctx, "phase "+string(p.name), attribute.String("cluster", r.ClusterName))
+		klog.InfoS("run phase", tracing.LogValues(phaseCtx, "phase", p.name, "name", r.ClusterName)...)
+		err := p.run(phaseCtx)
+		tracing.End(span, err)
+		result := PhaseResult{Name: p.name, State: PhaseSucceeded, Duration: time.Since(start)}
+		if err != nil {
+			result.State = PhaseFailed
+		}
+		metrics.PhaseDuration.WithLabelValues(string(p.name), result.State).Observe(result.Duration.Seconds())
+		if err != nil {
+			r.Phases = append(r.Phases, result)
+			err = fmt.Errorf("phase %s failed: %w", p.name, err)
+			r.Hub.Event(ctx, r.ClusterName, corev1.EventTypeWarning, "RegistrationFailed", "%v", err)
+			return r.rollback(ctx, err)
+		}
+		r.Phases = append(r.Phases, result)
+		if e, ok := phaseEvents[p.name]; ok && !r.stopped {
+			r.Hub.Event(ctx, r.ClusterName, corev1.EventTypeNormal, e.reason, e.message)
+		}
+		if err := r.complete(ctx, p); err != nil {
+			r.warn("fail to record checkpoint of phase %s: %v", p.name, err)
+		}
+		if p.name == r.Until {
+			return nil
+		}
+	}
+
+	r.Hub.Event(ctx, r.ClusterName, corev1.EventTypeNormal, "Registered", "spoke-cluster is registered")
+	// the next run starts from scratch
+	if r.checkpoint != nil {
+		return r.checkpoint.Reset(ctx)
+	}
+	return nil
+}
+
+// rollback undoes the changes of this run if RollbackOnFailure, the phase error is returned anyway
+func (r *Registration) rollback(ctx context.Context, phaseErr error) error {
+	if !r.RollbackOnFailure || r.DryRun {
+		return phaseErr
+	}
+	ctx, cancel := rollbackContext(ctx)
+	defer cancel()
+	klog.InfoS("roll back the registration", tracing.LogValues(ctx, "name", r.ClusterName, "objects", len(r.Tracker.Objects()))...)
+	if err := r.Tracker.Rollback(ctx); err != nil {
+		return fmt.Errorf("%w, and fail to roll back: %v", phaseErr, err)
+	}
+	// the rolled back phases have to be run again
+	if r.checkpoint != nil {
+		if err := r.checkpoint.Reset(ctx); err != nil {
+			klog.InfoS("Fail to reset checkpoint", tracing.LogValues(ctx, "err", err)...)
+		}
+	}
+	return phaseErr
+}
+
+// rollbackContext keeps the values of ctx for the rollback, but not its cancellation, since the registration
+// may fail because ctx is canceled or timed out
+func rollbackContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+}
+
+func (r *Registration) loadCheckpoint(ctx context.Context) error {
+	// dry-run doesn't write to the hub-cluster, and the stopped run isn't meant to be resumed
+	if r.DryRun || len(r.Until) != 0 {
+		return nil
+	}
+	hash, err := r.optionsHash()
+	if err != nil {
+		return err
+	}
+	checkpoint, err := r.Hub.LoadCheckpoint(ctx, r.ClusterName, hash)
+	if err != nil {
+		return err
+	}
+	if r.Restart {
+		if err = checkpoint.Reset(ctx); err != nil {
+			return err
+		}
+	}
+	r.checkpoint = checkpoint
+	return nil
+}
+
+// optionsHash is the hash of the options which change what the phases do, a checkpoint recorded with other options
+// is discarded. The credentials are left out, so that rotating them doesn't restart the registration.
+func (r *Registration) optionsHash() (string, error) {
+	spec := struct {
+		HubAPIServer         string
+		Overrides            *common.Overrides
+		Takeover             bool
+		Rebootstrap          bool
+		RenamedFrom          string
+		Accept               hub.AcceptOptions
+		PreProvision         bool
+		LeaseDurationSeconds int32
+		ClusterSet           string
+		ClusterSetBindings   []string
+		Claims               map[string]string
+		Addons               []hub.Addon
+		Verify               bool
+		Baseline             map[string][]byte
+		WaitBaseline         bool
+		CredentialType       string
+		GatewayClusterRole   string
+		Server               string
+	}{
+		HubAPIServer:         r.HubAPIServer,
+		Overrides:            r.Overrides,
+		Takeover:             r.Takeover,
+		Rebootstrap:          r.Rebootstrap,
+		RenamedFrom:          r.RenamedFrom,
+		Accept:               r.Accept,
+		PreProvision:         r.PreProvision,
+		LeaseDurationSeconds: r.LeaseDurationSeconds,
+		ClusterSet:           r.ClusterSet,
+		ClusterSetBindings:   r.ClusterSetBindings,
+		Claims:               r.Claims,
+		Addons:               r.Addons,
+		Verify:               r.Verify,
+		Baseline:             r.Baseline,
+		WaitBaseline:         r.WaitBaseline,
+		CredentialType:       r.CredentialType,
+		GatewayClusterRole:   r.GatewayClusterRole,
+	}
+	if r.SpokeConfig != nil {
+		spec.Server = r.SpokeConfig.Host
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16], nil
+}
+
+func (r *Registration) completed(p phase) bool {
+	// validate is always run, it doesn't change anything
+	return r.checkpoint != nil && p.name != PhaseValidate && r.checkpoint.Completed(string(p.name))
+}
+
+func (r *Registration) complete(ctx context.Context, p phase) error {
+	if r.checkpoint == nil || p.name == PhaseValidate {
+		return nil
+	}
+	return r.checkpoint.Complete(ctx, string(p.name))
+}
+
+func (r *Registration) validate(ctx context.Context) error {
+	if errs := validation.IsDNS1123Label(r.ClusterName); len(errs) != 0 {
+		return fmt.Errorf("invalid cluster name %q: %s", r.ClusterName, strings.Join(errs, ", "))
+	}
+	if r.SpokeConfig == nil {
+		return fmt.Errorf("the kubeconfig of spoke-cluster is required")
+	}
+	// the baseline is applied late, a colliding file is refused before any change is made
+	if _, err := r.Hub.RenderBaselineWorks(r.ClusterName, r.Baseline); err != nil {
+		return err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(r.SpokeConfig)
+	if err != nil {
+		return err
+	}
+	version, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("spoke-cluster is unreachable: %w", err)
+	}
+	klog.V(common.LogDebug).InfoS("spoke-cluster is reachable", tracing.LogValues(ctx, "version", version.GitVersion)...)
+
+	if err = r.connectSpoke(); err != nil {
+		return err
+	}
+
+	if err = r.checkJoinedHubs(ctx); err != nil {
+		return err
+	}
+
+	if err = r.checkKlusterletName(ctx); err != nil {
+		return err
+	}
+
+	r.fingerprint, err = r.Spoke.Fingerprint(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Hub.CheckFingerprint(ctx, r.ClusterName, r.fingerprint, r.RenamedFrom)
+}
+
+// connectSpoke creates the client of the spoke-cluster, which shares the overrides, tracker and dry-run of the
+// registration
+func (r *Registration) connectSpoke() error {
+	var err error
+	if r.Spoke, err = spoke.NewSpokeCluster(r.ClusterName, r.SpokeConfig, nil); err != nil {
+		return err
+	}
+	r.Spoke.Args.Overrides = r.Overrides
+	r.Spoke.Args.Tracker = r.Tracker
+	r.Spoke.Claims = r.Claims
+	if r.DryRun {
+		r.Spoke.Args.EnableDryRun()
+	}
+	return nil
+}
+
+// checkKlusterletName refuses to register a spoke-cluster whose klusterlet is registered with this hub-cluster
+// under another name, which isn't detected by the fingerprint if the ManagedCluster doesn't record it
+func (r *Registration) checkKlusterletName(ctx context.Context) error {
+	if r.takeover {
+		// the agents bootstrap again, with another hub-cluster or name
+		return nil
+	}
+	name, err := r.Spoke.GetKlusterletClusterName(ctx)
+	if err != nil {
+		return err
+	}
+	if len(name) != 0 && name != r.ClusterName && name != r.RenamedFrom {
+		return fmt.Errorf("spoke-cluster is already registered as %s by its klusterlet, rename or duplicate is refused", name)
+	}
+	return nil
+}
+
+// checkJoinedHubs refuses to hijack a spoke-cluster whose agent connects to another hub-cluster, unless Takeover
+func (r *Registration) checkJoinedHubs(ctx context.Context) error {
+	hubInfo, err := r.Hub.GetHubClusterInfo(ctx, r.HubAPIServer)
+	if err != nil {
+		return err
+	}
+	r.hubEndpoint = spoke.HubEndpoint{
+		Server: hubInfo.Clusters[0].Cluster.Server,
+		CAData: hubInfo.Clusters[0].Cluster.CertificateAuthorityData,
+	}
+
+	joinedHubs, err := r.Spoke.GetJoinedHubs(ctx)
+	if err != nil {
+		return err
+	}
+	for secretName, joined := range joinedHubs {
+		reason := diffHubEndpoint(joined, r.hubEndpoint)
+		if len(reason) == 0 {
+			continue
+		}
+		if !r.Takeover {
+			return fmt.Errorf("spoke-cluster is joined to another hub %s (%s in secret %s), use takeover to register it anyway",
+				joined.Server, reason, secretName)
+		}
+		klog.InfoS("take over spoke-cluster joined to another hub, the ManagedCluster on that hub has to be removed manually",
+			tracing.LogValues(ctx, "hub", joined.Server, "reason", reason, "secret", secretName)...)
+		r.takeover = true
+	}
+	if r.Rebootstrap && len(joinedHubs) != 0 {
+		r.takeover = true
+	}
+	return nil
+}
+
+func diffHubEndpoint(joined, expected spoke.HubEndpoint) string {
+	if joined.Server != expected.Server {
+		return fmt.Sprintf("server %s differs from %s", joined.Server, expected.Server)
+	}
+	if len(joined.CAData) != 0 && !bytes.Equal(joined.CAData, expected.CAData) {
+		return "certificate authority differs"
+	}
+	return ""
+}
+
+func (r *Registration) generateHubKubeConfig(ctx context.Context) error {
+	if shared := r.HubKubeConfig; shared != nil && len(shared.AuthInfos) == 1 &&
+		(r.DryRun || hub.TokenValid(shared.AuthInfos[0].AuthInfo.Token, tokenReuseMargin)) {
+		klog.Info("use the shared token for spoke-cluster to connect hub-cluster")
+		r.Spoke.HubInfo.KubeConfig = shared
+		return nil
+	}
+	klog.Info("generate the token for spoke-cluster to connect hub-cluster")
+	hubKubeConfig, err := r.Hub.GenerateHubClusterKubeConfig(ctx, r.HubAPIServer)
+	if err != nil {
+		return err
+	}
+	r.Spoke.HubInfo.KubeConfig = hubKubeConfig
+	return nil
+}
+
+// reuseHubKubeConfig reuses the bootstrap kubeconfig applied to spoke-cluster by previous run,
+// as long as its token is still valid
+func (r *Registration) reuseHubKubeConfig(ctx context.Context) error {
+	hubKubeConfig, err := r.Spoke.GetBootstrapHubKubeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if len(hubKubeConfig.Clusters) != 1 || len(hubKubeConfig.AuthInfos) != 1 {
+		return fmt.Errorf("unexpected bootstrap kubeconfig")
+	}
+	joined := spoke.HubEndpoint{
+		Server: hubKubeConfig.Clusters[0].Cluster.Server,
+		CAData: hubKubeConfig.Clusters[0].Cluster.CertificateAuthorityData,
+	}
+	if reason := diffHubEndpoint(joined, r.hubEndpoint); len(reason) != 0 {
+		return fmt.Errorf("bootstrap kubeconfig is for another hub: %s", reason)
+	}
+	if !hub.TokenValid(hubKubeConfig.AuthInfos[0].AuthInfo.Token, tokenReuseMargin) {
+		return fmt.Errorf("bootstrap token expired")
+	}
+	r.Spoke.HubInfo.KubeConfig = hubKubeConfig
+	return nil
+}
+
+func (r *Registration) initSpokeEnv(ctx context.Context) error {
+	if r.takeover {
+		if err := r.Spoke.ResetHubKubeConfig(ctx); err != nil {
+			return err
+		}
+	}
+	klog.InfoS("prepare the env for spoke-cluster", tracing.LogValues(ctx, "name", r.ClusterName)...)
+	if err := r.Spoke.InitSpokeClusterEnv(ctx); err != nil {
+		return err
+	}
+	if r.takeover && !r.DryRun {
+		return r.Spoke.RestartAgents(ctx)
+	}
+	return nil
+}
+
+func (r *Registration) waitForCSR(ctx context.Context) error {
+	if r.DryRun {
+		// the agent never starts in dry-run, only the existing csr can be approved
+		csrs, err := r.Hub.ListSpokeClusterCSRs(ctx, r.ClusterName)
+		if err != nil {
+			return err
+		}
+		if len(csrs) == 0 {
+			klog.InfoS("dry-run finished, no csr to approve yet", tracing.LogValues(ctx, "name", r.ClusterName)...)
+			r.stopped = true
+		}
+		return nil
+	}
+
+	klog.Info("wait for spoke-cluster register request")
+	if r.PreProvision {
+		return r.Hub.WaitForSpokeClusterCSR(ctx, r.ClusterName)
+	}
+	ready, err := r.Hub.WaitForSpokeClusterReady(ctx, r.ClusterName)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return fmt.Errorf("spoke-cluster register request isn't ready")
+	}
+	return nil
+}
+
+func (r *Registration) approve(ctx context.Context) error {
+	klog.Info("approve spoke cluster csr")
+	if err := r.Hub.ApproveSpokeClusterCSR(ctx, r.ClusterName); err != nil {
+		return err
+	}
+	approved, denied, err := r.Hub.GetSpokeClusterCSRStatus(ctx, r.ClusterName)
+	if err != nil {
+		return err
+	}
+	for _, name := range denied {
+		metrics.CSRs.WithLabelValues("denied").Inc()
+		r.warn("csr %s is denied", name)
+		r.Hub.Event(ctx, r.ClusterName, corev1.EventTypeWarning, "CSRDenied", "csr %s is denied", name)
+	}
+	if len(approved) != 0 {
+		r.Hub.Event(ctx, r.ClusterName, corev1.EventTypeNormal, "CSRApproved", "csr %s approved", strings.Join(approved, ", "))
+	}
+	r.ApprovedCSRs = approved
+	return nil
+}
+
+func (r *Registration) accept(ctx context.Context) error {
+	klog.Info("accept spoke cluster")
+	return r.Hub.AcceptSpokeCluster(ctx, r.ClusterName, r.acceptOptions())
+}
+
+// acceptOptions adds the fingerprint and cluster set to the user provided metadata
+func (r *Registration) acceptOptions() hub.AcceptOptions {
+	opts := r.Accept
+	opts.Annotations = map[string]string{hub.FingerprintAnnotation: r.fingerprint}
+	for k, v := range r.Accept.Annotations {
+		opts.Annotations[k] = v
+	}
+	if len(r.ClusterSet) != 0 {
+		opts.Labels = map[string]string{}
+		for k, v := range r.Accept.Labels {
+			opts.Labels[k] = v
+		}
+		opts.Labels[ocmclusterv1beta2.ClusterSetLabel] = r.ClusterSet
+	}
+	return opts
+}
+
+func (r *Registration) ensureClusterSet(ctx context.Context) error {
+	if len(r.ClusterSet) == 0 {
+		return nil
+	}
+	klog.InfoS("ensure managed cluster set", tracing.LogValues(ctx, "name", r.ClusterSet, "bindings", r.ClusterSetBindings)...)
+	return r.Hub.EnsureManagedClusterSet(ctx, r.ClusterSet, r.ClusterSetBindings)
+}
+
+func (r *Registration) preProvision(ctx context.Context) error {
+	if !r.PreProvision {
+		return nil
+	}
+	caBundle := r.SpokeConfig.CAData
+	if len(caBundle) == 0 && len(r.SpokeConfig.CAFile) != 0 {
+		data, err := os.ReadFile(r.SpokeConfig.CAFile)
+		if err != nil {
+			return err
+		}
+		caBundle = data
+	}
+	return r.Hub.ProvisionManagedCluster(ctx, r.ClusterName, r.acceptOptions(), hub.ProvisionOptions{
+		LeaseDurationSeconds: r.LeaseDurationSeconds,
+		ClientConfigs:        []ocmclusterv1.ClientConfig{{URL: r.SpokeConfig.Host, CABundle: caBundle}},
+	})
+}
+
+func (r *Registration) waitForAvailable(ctx context.Context) error {
+	if r.DryRun {
+		return nil
+	}
+	klog.Info("wait for spoke cluster available")
+	return r.Hub.WaitForSpokeClusterAvailable(ctx, r.ClusterName)
+}
+
+func (r *Registration) verify(ctx context.Context) error {
+	if !r.Verify || r.DryRun {
+		return nil
+	}
+	klog.InfoS("verify the work agent with a smoke test ManifestWork", tracing.LogValues(ctx, "name", r.ClusterName)...)
+	var err error
+	r.VerifyResult, err = r.Hub.VerifyManifestWork(ctx, r.ClusterName, verifyTimeout)
+	return err
+}
+
+func (r *Registration) applyBaseline(ctx context.Context) error {
+	if len(r.Baseline) == 0 {
+		return nil
+	}
+	klog.InfoS("apply baseline manifests", tracing.LogValues(ctx, "name", r.ClusterName, "files", len(r.Baseline))...)
+	works, err := r.Hub.ApplyBaseline(ctx, r.ClusterName, r.Baseline)
+	if err != nil {
+		return err
+	}
+	if !r.WaitBaseline || r.DryRun {
+		return nil
+	}
+	return r.Hub.WaitForWorksApplied(ctx, r.ClusterName, works, baselineTimeout)
+}
+
+func (r *Registration) enableAddons(ctx context.Context) error {
+	if len(r.Addons) == 0 {
+		return nil
+	}
+	klog.InfoS("enable addons", tracing.LogValues(ctx, "name", r.ClusterName, "addons", r.Addons)...)
+	if err := r.Hub.EnableAddons(ctx, r.ClusterName, r.Addons); err != nil {
+		return err
+	}
+	if r.DryRun {
+		return nil
+	}
+	var err error
+	r.AddonStatus, err = r.Hub.WaitForAddonsAvailable(ctx, r.ClusterName, r.Addons, addonTimeout)
+	for _, status := range r.AddonStatus {
+		if !status.Available {
+			r.warn("addon %s isn't available: %s", status.Name, status.Message)
+		}
+	}
+	return err
+}
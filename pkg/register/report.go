@@ -0,0 +1,120 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+const (
+	// PhaseSucceeded is the state of a phase run by this registration
+	PhaseSucceeded = "Succeeded"
+	// PhaseFailed is the state of the phase failing the registration
+	PhaseFailed = "Failed"
+	// PhaseSkipped is the state of a phase completed by a previous run
+	PhaseSkipped = "Skipped"
+	// PhaseResumed is the state of a phase completed by a previous run whose state is restored
+	PhaseResumed = "Resumed"
+)
+
+// maxTerminationMessage is the limit of kubelet on the termination message of a container
+const maxTerminationMessage = 4096
+
+// PhaseResult is the outcome of a phase
+type PhaseResult struct {
+	Name     Phase
+	State    string
+	Duration time.Duration
+}
+
+// Report is the machine-readable outcome of a registration
+type Report struct {
+	Cluster      string            `json:"cluster"`
+	Backend      string            `json:"backend"`
+	Succeeded    bool              `json:"succeeded"`
+	Error        string            `json:"error,omitempty"`
+	UID          string            `json:"uid,omitempty"`
+	Phases       []PhaseReport     `json:"phases,omitempty"`
+	ApprovedCSRs []string          `json:"approvedCSRs,omitempty"`
+	AgentImages  map[string]string `json:"agentImages,omitempty"`
+	Addons       []hub.AddonStatus `json:"addons,omitempty"`
+	Warnings     []string          `json:"warnings,omitempty"`
+}
+
+// PhaseReport is a phase of Report
+type PhaseReport struct {
+	Name     Phase  `json:"name"`
+	State    string `json:"state"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// NewReport creates the report of a registration of cluster with backend, err is the error of Run
+func NewReport(cluster, backend string, result *Result, err error) *Report {
+	report := &Report{
+		Cluster:      cluster,
+		Backend:      backend,
+		Succeeded:    err == nil,
+		UID:          string(result.UID),
+		ApprovedCSRs: result.ApprovedCSRs,
+		AgentImages:  result.AgentImages,
+		Addons:       result.AddonStatus,
+		Warnings:     result.Warnings,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	for _, p := range result.Phases {
+		phase := PhaseReport{Name: p.Name, State: p.State}
+		if p.State != PhaseSkipped {
+			phase.Duration = p.Duration.Round(time.Millisecond).String()
+		}
+		report.Phases = append(report.Phases, phase)
+	}
+	return report
+}
+
+// TerminationMessage encodes the report within the size limit of the termination message,
+// the details are dropped if the full report exceeds it
+func (r *Report) TerminationMessage() ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil || len(data) <= maxTerminationMessage {
+		return data, err
+	}
+	brief := Report{Cluster: r.Cluster, Backend: r.Backend, Succeeded: r.Succeeded, Error: r.Error, UID: r.UID,
+		Warnings: []string{"the details are dropped from the termination message"}}
+	if len(brief.Error) > maxTerminationMessage/2 {
+		brief.Error = brief.Error[:maxTerminationMessage/2]
+	}
+	return json.Marshal(brief)
+}
+
+// warn records a problem which doesn't fail the registration
+func (r *Registration) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	klog.InfoS("Warning of registration", "name", r.ClusterName, "warning", msg)
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// collectResult records the ManagedCluster and the agents the registration ends up with, as far as they exist
+func (r *Registration) collectResult(ctx context.Context) {
+	mc, err := r.Hub.GetManagedCluster(ctx, r.ClusterName)
+	switch {
+	case err == nil:
+		r.UID = mc.UID
+	case !kerrors.IsNotFound(err):
+		klog.V(common.LogDebug).InfoS("Fail to get managed cluster", "name", r.ClusterName, "err", err)
+	}
+	if r.Spoke == nil {
+		return
+	}
+	if r.AgentImages, err = r.Spoke.GetAgentImages(ctx); err != nil {
+		klog.V(common.LogDebug).InfoS("Fail to get agent images", "name", r.ClusterName, "err", err)
+	}
+}
@@ -0,0 +1,58 @@
+package register
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTerminationMessage(t *testing.T) {
+	cases := []struct {
+		name      string
+		report    Report
+		wantBrief bool
+	}{
+		{
+			name:   "full report within the limit",
+			report: Report{Cluster: "a", Backend: "ocm", Succeeded: true, ApprovedCSRs: []string{"csr-a"}},
+		},
+		{
+			name:      "details are dropped",
+			report:    Report{Cluster: "a", Backend: "ocm", UID: "uid", Error: "fail", Warnings: []string{strings.Repeat("w", maxTerminationMessage)}},
+			wantBrief: true,
+		},
+		{
+			name:      "error is truncated",
+			report:    Report{Cluster: "a", Backend: "ocm", Error: strings.Repeat("e", 2*maxTerminationMessage)},
+			wantBrief: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := c.report.TerminationMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) > maxTerminationMessage {
+				t.Fatalf("expect the message within %d bytes, got %d", maxTerminationMessage, len(data))
+			}
+			got := Report{}
+			if err = json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Cluster != c.report.Cluster || got.Backend != c.report.Backend || got.Succeeded != c.report.Succeeded ||
+				got.UID != c.report.UID || !strings.HasPrefix(c.report.Error, got.Error) || len(got.Error) == 0 != (len(c.report.Error) == 0) {
+				t.Errorf("expect the summary of %+v to be kept, got %+v", c.report, got)
+			}
+			if c.wantBrief {
+				if len(got.Warnings) != 1 || len(got.ApprovedCSRs) != 0 {
+					t.Errorf("expect the details to be dropped, got %+v", got)
+				}
+				return
+			}
+			if len(got.ApprovedCSRs) != len(c.report.ApprovedCSRs) {
+				t.Errorf("expect the full report, got %+v", got)
+			}
+		})
+	}
+}
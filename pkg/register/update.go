@@ -0,0 +1,41 @@
+package register
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/hub"
+	"github.com/oam-dev/cluster-register/pkg/tracing"
+)
+
+// Update reconciles the metadata, cluster set, ClusterClaims, baseline and add-ons of a registered ManagedCluster
+// with the options. The ClusterClaims are the only change to the spoke-cluster, its agents are left untouched.
+func (r *Registration) Update(ctx context.Context) error {
+	mc, err := r.Hub.GetManagedCluster(ctx, r.ClusterName)
+	if err != nil {
+		return err
+	}
+	// keep the fingerprint recorded by the registration
+	r.fingerprint = mc.Annotations[hub.FingerprintAnnotation]
+
+	klog.InfoS("update registered cluster", tracing.LogValues(ctx, "name", r.ClusterName)...)
+	for _, step := range []func(context.Context) error{r.ensureClusterSet, r.accept, r.applyClaims, r.applyBaseline, r.enableAddons} {
+		if err = step(ctx); err != nil {
+			return r.rollback(ctx, err)
+		}
+	}
+	return nil
+}
+
+// applyClaims creates the generated and the user provided ClusterClaims on the spoke-cluster
+func (r *Registration) applyClaims(ctx context.Context) error {
+	if r.SpokeConfig == nil {
+		return fmt.Errorf("the kubeconfig of spoke-cluster is required")
+	}
+	if err := r.connectSpoke(); err != nil {
+		return err
+	}
+	return r.Spoke.ApplyClusterClaims(ctx)
+}
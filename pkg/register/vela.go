@@ -0,0 +1,126 @@
+package register
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/oam-dev/cluster-register/pkg/gateway"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+// ImportOptions are the inputs of importing the cluster-gateway clusters of KubeVela as OCM ManagedClusters
+type ImportOptions struct {
+	// Options is the template of each registration, ClusterName and SpokeConfig are taken from the cluster secret
+	Options
+	// Clusters are the names of the cluster secrets to import, all of them if empty
+	Clusters []string
+	// SwitchToOCM makes cluster-gateway reach the imported clusters through OCM
+	SwitchToOCM bool
+	// InsecureSkipTLSVerify imports the cluster secrets without ca.crt, not verifying the server certificate
+	InsecureSkipTLSVerify bool
+}
+
+// ImportResult is the outcome of importing one cluster secret
+type ImportResult struct {
+	Cluster string
+	// Skipped is the reason the cluster secret isn't imported, if any
+	Skipped string
+	Err     error
+}
+
+// ImportFromVela registers the spoke-cluster of every cluster-gateway secret on hub-cluster to OCM, one by one.
+// The credential in the secret is reused, and the secret is annotated with the ManagedCluster once registered.
+// If SwitchToOCM, the cluster-proxy add-on is enabled, and the secret is only switched once the add-on is available.
+// A failed cluster doesn't stop the others, a selected cluster without secret fails.
+func ImportFromVela(ctx context.Context, hubCluster *hub.Cluster, opts ImportOptions) ([]ImportResult, error) {
+	secrets, err := gateway.ListClusterSecrets(ctx, hubCluster.Client)
+	if err != nil {
+		return nil, fmt.Errorf("fail to list cluster secrets: %w", err)
+	}
+	selected := sets.NewString(opts.Clusters...)
+	if opts.SwitchToOCM {
+		opts.Addons = withAddon(opts.Addons, gateway.ClusterProxyAddon)
+	}
+
+	var results []ImportResult
+	found := sets.NewString()
+	for i := range secrets {
+		secret := &secrets[i]
+		if selected.Len() != 0 && !selected.Has(secret.Name) {
+			continue
+		}
+		found.Insert(secret.Name)
+		result := ImportResult{Cluster: secret.Name}
+		if managedCluster, ok := secret.Annotations[gateway.ManagedClusterAnnotation]; ok {
+			result.Skipped = fmt.Sprintf("already imported as %s", managedCluster)
+			results = append(results, result)
+			continue
+		}
+
+		kubeConfig, err := gateway.KubeConfigFromSecret(secret, opts.InsecureSkipTLSVerify)
+		if err != nil {
+			result.Skipped = err.Error()
+			results = append(results, result)
+			continue
+		}
+		regOpts := opts.Options
+		regOpts.ClusterName = secret.Name
+		if regOpts.SpokeConfig, err = hub.ConvertSpokeKubeConfig(kubeConfig); err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		regOpts.Accept.Labels = gateway.ClusterLabels(secret)
+		for k, v := range opts.Accept.Labels {
+			regOpts.Accept.Labels[k] = v
+		}
+
+		klog.InfoS("import cluster of KubeVela", "name", secret.Name)
+		if err = NewRegistration(hubCluster, regOpts).Run(ctx); err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		if opts.SwitchToOCM && !opts.DryRun {
+			if err = checkAddonAvailable(ctx, hubCluster, secret.Name, gateway.ClusterProxyAddon); err != nil {
+				result.Err = fmt.Errorf("cluster secret isn't switched to OCM: %w", err)
+				results = append(results, result)
+				continue
+			}
+		}
+		result.Err = gateway.MarkImported(ctx, hubCluster.Client, secret, secret.Name, opts.SwitchToOCM)
+		results = append(results, result)
+	}
+	for _, name := range opts.Clusters {
+		if !found.Has(name) {
+			found.Insert(name)
+			results = append(results, ImportResult{Cluster: name, Err: fmt.Errorf("cluster secret %s doesn't exist", name)})
+		}
+	}
+	return results, nil
+}
+
+// withAddon adds the add-on of name to addons, unless it's already enabled
+func withAddon(addons []hub.Addon, name string) []hub.Addon {
+	for _, addon := range addons {
+		if addon.Name == name {
+			return addons
+		}
+	}
+	return append(append([]hub.Addon{}, addons...), hub.Addon{Name: name})
+}
+
+// checkAddonAvailable returns an error unless the add-on of the managed cluster is available
+func checkAddonAvailable(ctx context.Context, hubCluster *hub.Cluster, clusterName, name string) error {
+	statuses, err := hubCluster.GetAddonStatus(ctx, clusterName, []hub.Addon{{Name: name}})
+	if err != nil {
+		return fmt.Errorf("fail to get addon %s: %w", name, err)
+	}
+	if !statuses[0].Available {
+		return fmt.Errorf("addon %s isn't available: %s", name, statuses[0].Message)
+	}
+	return nil
+}
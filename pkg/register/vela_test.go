@@ -0,0 +1,80 @@
+package register
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+	"github.com/oam-dev/cluster-register/pkg/gateway"
+	"github.com/oam-dev/cluster-register/pkg/hub"
+)
+
+func TestImportFromVelaReportsMissingClusters(t *testing.T) {
+	imported := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   gateway.Namespace,
+		Name:        "a",
+		Labels:      map[string]string{gateway.CredentialTypeLabel: gateway.CredentialTypeServiceAccountToken},
+		Annotations: map[string]string{gateway.ManagedClusterAnnotation: "a"},
+	}}
+	hubCluster := &hub.Cluster{Args: common.Args{Client: fake.NewClientBuilder().WithScheme(common.Scheme).WithObjects(imported).Build()}}
+
+	results, err := ImportFromVela(context.Background(), hubCluster, ImportOptions{Clusters: []string{"missing", "a", "missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expect 2 results, got %+v", results)
+	}
+	if results[0].Cluster != "a" || len(results[0].Skipped) == 0 || results[0].Err != nil {
+		t.Errorf("expect a to be skipped, got %+v", results[0])
+	}
+	if results[1].Cluster != "missing" || results[1].Err == nil {
+		t.Errorf("expect missing to fail, got %+v", results[1])
+	}
+}
+
+func TestCheckAddonAvailable(t *testing.T) {
+	addon := func(status metav1.ConditionStatus) client.Object {
+		return &addonv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: gateway.ClusterProxyAddon},
+			Status: addonv1alpha1.ManagedClusterAddOnStatus{Conditions: []metav1.Condition{{
+				Type: addonv1alpha1.ManagedClusterAddOnConditionAvailable, Status: status, Reason: "Test",
+			}}},
+		}
+	}
+	cases := []struct {
+		name    string
+		objects []client.Object
+		wantErr bool
+	}{
+		{name: "available", objects: []client.Object{addon(metav1.ConditionTrue)}},
+		{name: "unavailable", objects: []client.Object{addon(metav1.ConditionFalse)}, wantErr: true},
+		{name: "not enabled", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hubCluster := &hub.Cluster{Args: common.Args{Client: fake.NewClientBuilder().WithScheme(common.Scheme).WithObjects(c.objects...).Build()}}
+			err := checkAddonAvailable(context.Background(), hubCluster, "a", gateway.ClusterProxyAddon)
+			if (err != nil) != c.wantErr {
+				t.Errorf("expect error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWithAddon(t *testing.T) {
+	addons := []hub.Addon{{Name: "managed-serviceaccount"}}
+	if got := withAddon(addons, gateway.ClusterProxyAddon); len(got) != 2 || got[1].Name != gateway.ClusterProxyAddon || len(addons) != 1 {
+		t.Errorf("expect cluster-proxy to be added, got %v", got)
+	}
+	addons = []hub.Addon{{Name: gateway.ClusterProxyAddon, InstallNamespace: "proxy"}}
+	if got := withAddon(addons, gateway.ClusterProxyAddon); len(got) != 1 || got[0].InstallNamespace != "proxy" {
+		t.Errorf("expect the enabled add-on to be kept, got %v", got)
+	}
+}
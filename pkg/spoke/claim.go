@@ -0,0 +1,194 @@
+package spoke
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+	ocmclusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/cluster-register/pkg/common"
+)
+
+const (
+	// ClaimID is the well-known claim of the unique identifier of a cluster
+	ClaimID = "id.k8s.io"
+	// ClaimKubeVersion is the claim of the kubernetes version
+	ClaimKubeVersion = "kubeversion.open-cluster-management.io"
+	// ClaimPlatform is the claim of the cloud platform inferred from the providerID of nodes
+	ClaimPlatform = "platform.open-cluster-management.io"
+	// ClaimRegion is the claim of the region of nodes
+	ClaimRegion = "region.open-cluster-management.io"
+	// ClaimZones is the claim of the zones of nodes, in the form of zone1,zone2
+	ClaimZones = "zones.cluster-register.oam.dev"
+	// ClaimNodeCount is the claim of the number of nodes
+	ClaimNodeCount = "node-count.cluster-register.oam.dev"
+
+	clusterClaimCRD = "clusterclaims.cluster.open-cluster-management.io"
+)
+
+// platforms maps the scheme of node providerID to platform
+var platforms = map[string]string{
+	"aws":       "AWS",
+	"gce":       "GCP",
+	"azure":     "Azure",
+	"alicloud":  "AlibabaCloud",
+	"ibm":       "IBM",
+	"openstack": "OpenStack",
+	"vsphere":   "VSphere",
+}
+
+// ParseClaims parses claims in the form of name1=value1,name2=value2
+func ParseClaims(s string) (map[string]string, error) {
+	claims := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+		name, value, err := ParseClaim(item)
+		if err != nil {
+			return nil, err
+		}
+		claims[name] = value
+	}
+	return claims, nil
+}
+
+// ParseClaim parses a single claim in the form of name=value, the value may contain commas
+func ParseClaim(s string) (string, string, error) {
+	name, value, found := strings.Cut(strings.TrimSpace(s), "=")
+	if !found || len(value) == 0 {
+		return "", "", fmt.Errorf("invalid claim %q, expect <name>=<value>", s)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return "", "", fmt.Errorf("invalid claim name %s: %s", name, strings.Join(errs, ", "))
+	}
+	return name, value, nil
+}
+
+// GenerateClusterClaims inspects the spoke-cluster for the claims of its identity, version, size and location
+func (c *Cluster) GenerateClusterClaims(ctx context.Context) (map[string]string, error) {
+	claims := map[string]string{}
+	id, err := c.Fingerprint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims[ClaimID] = id
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(c.Args.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	version, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	claims[ClaimKubeVersion] = version.GitVersion
+
+	nodes := new(corev1.NodeList)
+	if err = c.Args.Client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	claims[ClaimNodeCount] = strconv.Itoa(len(nodes.Items))
+	platform := "Other"
+	regions, zones := sets.NewString(), sets.NewString()
+	for _, node := range nodes.Items {
+		if scheme, _, found := strings.Cut(node.Spec.ProviderID, "://"); found {
+			if p, ok := platforms[scheme]; ok {
+				platform = p
+			}
+		}
+		if region := node.Labels[corev1.LabelTopologyRegion]; len(region) != 0 {
+			regions.Insert(region)
+		}
+		if zone := node.Labels[corev1.LabelTopologyZone]; len(zone) != 0 {
+			zones.Insert(zone)
+		}
+	}
+	claims[ClaimPlatform] = platform
+	if regions.Len() != 0 {
+		claims[ClaimRegion] = strings.Join(regions.List(), ",")
+	}
+	if zones.Len() != 0 {
+		claims[ClaimZones] = strings.Join(zones.List(), ",")
+	}
+	return claims, nil
+}
+
+// RenderClusterClaims renders the ClusterClaims of claims, ordered by name
+func (c *Cluster) RenderClusterClaims(claims map[string]string) ([]*unstructured.Unstructured, error) {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resources := c.resources()
+	var objects []*unstructured.Unstructured
+	for _, name := range names {
+		obj, err := common.ToUnstructured(&ocmclusterv1alpha1.ClusterClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       ocmclusterv1alpha1.ClusterClaimSpec{Value: claims[name]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = resources.Overrides.Patch(obj); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// ApplyClusterClaims creates the generated claims together with the user provided Claims, which take precedence.
+// The ClusterClaim CRD is installed by the klusterlet, so it is waited for first.
+func (c *Cluster) ApplyClusterClaims(ctx context.Context) error {
+	claims, err := c.GenerateClusterClaims(ctx)
+	if err != nil {
+		return fmt.Errorf("fail to generate cluster claims: %w", err)
+	}
+	for name, value := range c.Claims {
+		claims[name] = value
+	}
+	objects, err := c.RenderClusterClaims(claims)
+	if err != nil {
+		return err
+	}
+	if !c.Args.DryRun {
+		if err = c.waitForClusterClaimCRD(ctx); err != nil {
+			return err
+		}
+	}
+	klog.InfoS("apply cluster claims", "count", len(objects))
+	return c.Args.ApplyObjects(ctx, objects)
+}
+
+func (c *Cluster) waitForClusterClaimCRD(ctx context.Context) error {
+	return wait.PollUntilContextTimeout(ctx, time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		crd := new(crdv1.CustomResourceDefinition)
+		if err := c.Args.Client.Get(ctx, client.ObjectKey{Name: clusterClaimCRD}, crd); err != nil {
+			klog.V(common.LogDebug).InfoS("Waiting for CRD", "name", clusterClaimCRD, "err", err)
+			return false, nil
+		}
+		for _, cond := range crd.Status.Conditions {
+			if cond.Type == crdv1.Established && cond.Status == crdv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
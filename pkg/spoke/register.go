@@ -5,14 +5,19 @@ import (
 	"context"
 	"embed"
 	"encoding/base64"
+	"fmt"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/Masterminds/sprig"
 	"github.com/ghodss/yaml"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
@@ -23,10 +28,23 @@ import (
 	"github.com/oam-dev/cluster-register/pkg/common"
 )
 
+const (
+	// OperatorNamespace is the namespace of the klusterlet operator
+	OperatorNamespace = "open-cluster-management"
+	// AgentNamespace is the namespace of the registration and work agent
+	AgentNamespace = "open-cluster-management-agent"
+	// BootstrapHubKubeConfigSecret is the secret contains the kubeconfig to bootstrap with hub-cluster
+	BootstrapHubKubeConfigSecret = "bootstrap-hub-kubeconfig"
+	// HubKubeConfigSecret is the secret contains the kubeconfig the agent got after bootstrap
+	HubKubeConfigSecret = "hub-kubeconfig-secret"
+)
+
 type Cluster struct {
 	Name string
 	Args common.Args
 	HubInfo
+	// Claims are created as ClusterClaims besides the generated ones
+	Claims map[string]string
 }
 
 type SpokeInfo struct {
@@ -111,7 +129,25 @@ func NewSpokeCluster(name string, config *rest.Config, hubConfig *clientcmdapiv1
 	}, nil
 }
 
+func (c *Cluster) resources() common.Resources {
+	return common.Resources{FS: f, Component: "spoke", Overrides: c.Args.Overrides}
+}
+
 func (c *Cluster) InitSpokeClusterEnv(ctx context.Context) error {
+	objects, err := c.RenderSpokeClusterEnv()
+	if err != nil {
+		return err
+	}
+	if err = c.Args.ApplyObjects(ctx, objects); err != nil {
+		return err
+	}
+	return c.ApplyClusterClaims(ctx)
+}
+
+// RenderSpokeClusterEnv renders all the objects InitSpokeClusterEnv applies, in the order of applying.
+// It doesn't contact the spoke-cluster.
+func (c *Cluster) RenderSpokeClusterEnv() ([]*unstructured.Unstructured, error) {
+	resources := c.resources()
 	files := []string{
 		"resource/namespace_agent.yaml",
 		"resource/namespace.yaml",
@@ -120,33 +156,136 @@ func (c *Cluster) InitSpokeClusterEnv(ctx context.Context) error {
 		"resource/klusterlets.crd.yaml",
 		"resource/service_account.yaml",
 	}
-	// 1. apply ns rbac crd
-	err := common.ApplyK8sResource(ctx, f, c.Args.Client, files)
-	if err != nil {
-		return err
+	files = append(files, resources.ExtraFiles("resource")...)
+
+	// 1. ns rbac crd and the additional user provided resources
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		fileObjects, err := resources.Objects(file)
+		if err != nil {
+			klog.Error(err, "Fail to load resource file ", "name:", file)
+			return nil, err
+		}
+		objects = append(objects, fileObjects...)
 	}
 
-	// 2. render secret contains hub kubeconfig
+	// 2. secret contains hub kubeconfig
 	hubConfigSecret := "resource/bootstrap_hub_kubeconfig.yaml"
-	err = applyHubKubeConfig(ctx, c.Args.Client, hubConfigSecret, c.HubInfo.KubeConfig)
+	secrets, err := renderHubKubeConfig(resources, hubConfigSecret, c.HubInfo.KubeConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	objects = append(objects, secrets...)
 
-	// 3. apply deployment
-	opreatorFile := []string{"resource/operator.yaml"}
-	err = common.ApplyK8sResource(ctx, f, c.Args.Client, opreatorFile)
+	// 3. deployment
+	operators, err := resources.Objects("resource/operator.yaml")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	objects = append(objects, operators...)
 
-	// 4. apply klusterlet
+	// 4. klusterlet
 	klusterFile := "resource/klusterlets.cr.yaml"
-	err = applyKlusterlet(ctx, c.Args.Client, klusterFile, c)
+	klusterlets, err := renderKlusterlet(resources, klusterFile, c)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return append(objects, klusterlets...), nil
+}
+
+// GetBootstrapHubKubeConfig gets the hub kubeconfig from the bootstrap secret of spoke-cluster
+func (c *Cluster) GetBootstrapHubKubeConfig(ctx context.Context) (*clientcmdapiv1.Config, error) {
+	return c.getHubKubeConfig(ctx, BootstrapHubKubeConfigSecret)
+}
+
+func (c *Cluster) getHubKubeConfig(ctx context.Context, secretName string) (*clientcmdapiv1.Config, error) {
+	secret := new(corev1.Secret)
+	key := client.ObjectKey{Namespace: AgentNamespace, Name: secretName}
+	if err := c.Args.Client.Get(ctx, key, secret); err != nil {
+		return nil, err
+	}
+	kubeConfig := new(clientcmdapiv1.Config)
+	if err := yaml.Unmarshal(secret.Data["kubeconfig"], kubeConfig); err != nil {
+		return nil, err
+	}
+	return kubeConfig, nil
+}
+
+// Fingerprint returns the UID of kube-system namespace, which identifies the physical spoke-cluster
+func (c *Cluster) Fingerprint(ctx context.Context) (string, error) {
+	ns := new(corev1.Namespace)
+	if err := c.Args.Client.Get(ctx, client.ObjectKey{Name: metav1.NamespaceSystem}, ns); err != nil {
+		return "", err
+	}
+	return string(ns.UID), nil
+}
+
+// GetKlusterletClusterName returns the cluster name the klusterlet registers with, empty if it isn't deployed
+func (c *Cluster) GetKlusterletClusterName(ctx context.Context) (string, error) {
+	klusterlet := new(ocmapiv1.Klusterlet)
+	err := c.Args.Client.Get(ctx, client.ObjectKey{Name: "klusterlet"}, klusterlet)
+	if kerrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return klusterlet.Spec.ClusterName, nil
+}
+
+// HubEndpoint is the address and CA of the hub-cluster an agent connects to
+type HubEndpoint struct {
+	Server string
+	CAData []byte
+}
+
+// GetJoinedHubs returns the hub-clusters in the bootstrap and hub kubeconfig secrets of the agent, keyed by secret name
+func (c *Cluster) GetJoinedHubs(ctx context.Context) (map[string]HubEndpoint, error) {
+	hubs := map[string]HubEndpoint{}
+	for _, secretName := range []string{BootstrapHubKubeConfigSecret, HubKubeConfigSecret} {
+		kubeConfig, err := c.getHubKubeConfig(ctx, secretName)
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range kubeConfig.Clusters {
+			hubs[secretName] = HubEndpoint{Server: cluster.Cluster.Server, CAData: cluster.Cluster.CertificateAuthorityData}
+		}
+	}
+	return hubs, nil
+}
+
+// ResetHubKubeConfig deletes the hub kubeconfig the agent got from its current hub-cluster,
+// so that the agent bootstraps again with the bootstrap kubeconfig
+func (c *Cluster) ResetHubKubeConfig(ctx context.Context) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: AgentNamespace, Name: HubKubeConfigSecret}}
+	klog.InfoS("delete hub kubeconfig of agent", "object", klog.KObj(secret))
+	return client.IgnoreNotFound(c.Args.Client.Delete(ctx, secret))
+}
+
+// RestartAgents deletes the pods of the registration and work agent, they are recreated by their deployments
+func (c *Cluster) RestartAgents(ctx context.Context) error {
+	klog.InfoS("restart agents", "namespace", AgentNamespace)
+	return c.Args.Client.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(AgentNamespace))
+}
+
+// GetAgentImages returns the images of the klusterlet operator and agents, keyed by <deployment>/<container>
+func (c *Cluster) GetAgentImages(ctx context.Context) (map[string]string, error) {
+	images := map[string]string{}
+	for _, namespace := range []string{OperatorNamespace, AgentNamespace} {
+		deployments := new(appsv1.DeploymentList)
+		if err := c.Args.Client.List(ctx, deployments, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, d := range deployments.Items {
+			for _, container := range d.Spec.Template.Spec.Containers {
+				images[d.Name+"/"+container.Name] = container.Image
+			}
+		}
+	}
+	return images, nil
 }
 
 func (c *Cluster) WaitForRegistrationOperatorReady(ctx context.Context) error {
@@ -183,78 +322,102 @@ func (c *Cluster) WaitForRegistrationAgentReady(ctx context.Context) error {
 	}, ctx.Done())
 }
 
-func applyHubKubeConfig(ctx context.Context, k8sClient client.Client, file string, kubeConfig *clientcmdapiv1.Config) error {
+func renderTemplate(resources common.Resources, file string, data interface{}) ([]byte, error) {
+	content, err := resources.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
 	path := strings.Split(file, "/")
 	templateName := path[len(path)-1]
-	t, err := template.New(templateName).Funcs(sprig.TxtFuncMap()).ParseFS(f, file)
+	t, err := template.New(templateName).Funcs(sprig.TxtFuncMap()).Parse(string(content))
 	if err != nil {
 		klog.Error(err, "Fail to get Template from file", "name", file)
-		return err
-	}
-
-	kubeConfigData, err := yaml.Marshal(kubeConfig)
-	if err != nil {
-		klog.Error(err)
+		return nil, err
 	}
 
 	var buf bytes.Buffer
-	err = t.Execute(&buf, string(kubeConfigData))
+	err = t.Execute(&buf, data)
 	if err != nil {
-		klog.Error(err)
-		return err
+		klog.Error(err, "Fail to render template", "name", file)
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	kubeConfigSecret := new(corev1.Secret)
-	err = yaml.Unmarshal(buf.Bytes(), kubeConfigSecret)
+func renderHubKubeConfig(resources common.Resources, file string, kubeConfig *clientcmdapiv1.Config) ([]*unstructured.Unstructured, error) {
+	kubeConfigData, err := yaml.Marshal(kubeConfig)
 	if err != nil {
 		klog.Error(err)
-		return err
 	}
 
-	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: kubeConfigSecret.Namespace, Name: kubeConfigSecret.Name}, kubeConfigSecret)
+	data, err := renderTemplate(resources, file, string(kubeConfigData))
 	if err != nil {
-		if kerrors.IsNotFound(err) {
-			klog.V(common.LogDebug).InfoS("create secret", "object", klog.KObj(kubeConfigSecret))
-			return k8sClient.Create(ctx, kubeConfigSecret)
-		}
-		return err
+		return nil, err
 	}
 
-	klog.V(common.LogDebug).InfoS("update secret", "object", klog.KObj(kubeConfigSecret))
-	return k8sClient.Update(ctx, kubeConfigSecret)
-}
-
-func applyKlusterlet(ctx context.Context, k8sClient client.Client, file string, cluster *Cluster) error {
-	t, err := template.ParseFS(f, file)
+	kubeConfigSecrets, err := resources.Decode(data)
 	if err != nil {
-		klog.Error(err, "Fail to get Template from file", "name", file)
-		return err
+		klog.Error(err)
+		return nil, err
 	}
+	return kubeConfigSecrets, nil
+}
 
-	var buf bytes.Buffer
-	err = t.Execute(&buf, cluster)
+func renderKlusterlet(resources common.Resources, file string, cluster *Cluster) ([]*unstructured.Unstructured, error) {
+	data, err := renderTemplate(resources, file, cluster)
 	if err != nil {
 		klog.Error(err, "Fail to render klusterlet")
-		return err
+		return nil, err
 	}
 
-	klusterlet := new(ocmapiv1.Klusterlet)
-	err = yaml.Unmarshal(buf.Bytes(), klusterlet)
+	klusterlets, err := resources.Decode(data)
 	if err != nil {
 		klog.Error(err, "Fail to Unmarshal klusterlet")
-		return err
+		return nil, err
+	}
+	return klusterlets, nil
+}
+
+// SealedSecretPlaceholder converts a rendered secret to a SealedSecret whose encrypted data are placeholders,
+// so that the secret can be sealed by kubeseal instead of being stored in git
+func SealedSecretPlaceholder(secret *unstructured.Unstructured) *unstructured.Unstructured {
+	encryptedData := map[string]interface{}{}
+	data, _, _ := unstructured.NestedMap(secret.Object, "data")
+	for key := range data {
+		encryptedData[key] = fmt.Sprintf("<sealed %s of secret %s/%s>", key, secret.GetNamespace(), secret.GetName())
+	}
+	templateMetadata := map[string]interface{}{
+		"name":      secret.GetName(),
+		"namespace": secret.GetNamespace(),
+	}
+	if labels := secret.GetLabels(); len(labels) != 0 {
+		templateMetadata["labels"] = toInterfaceMap(labels)
 	}
+	if annotations := secret.GetAnnotations(); len(annotations) != 0 {
+		templateMetadata["annotations"] = toInterfaceMap(annotations)
+	}
+	secretType, _, _ := unstructured.NestedString(secret.Object, "type")
 
-	latestKlusterlet := &ocmapiv1.Klusterlet{}
-	err = k8sClient.Get(ctx, client.ObjectKey{Name: klusterlet.Name, Namespace: klusterlet.Namespace}, latestKlusterlet)
-	if err != nil {
-		if kerrors.IsNotFound(err) {
-			klog.V(common.LogDebug).InfoS("create klusterlet", "object", klog.KObj(klusterlet))
-			return k8sClient.Create(ctx, klusterlet)
-		}
-		return err
+	sealedSecret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"encryptedData": encryptedData,
+			"template": map[string]interface{}{
+				"metadata": templateMetadata,
+				"type":     secretType,
+			},
+		},
+	}}
+	sealedSecret.SetAPIVersion("bitnami.com/v1alpha1")
+	sealedSecret.SetKind("SealedSecret")
+	sealedSecret.SetName(secret.GetName())
+	sealedSecret.SetNamespace(secret.GetNamespace())
+	return sealedSecret
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
 	}
-	klusterlet.ResourceVersion = latestKlusterlet.ResourceVersion
-	klog.V(common.LogDebug).InfoS("update klusterlet", "object", klog.KObj(klusterlet))
-	return k8sClient.Update(ctx, klusterlet)
+	return res
 }
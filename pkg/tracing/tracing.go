@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+// ServiceName is the service name of the spans
+const ServiceName = "cluster-register"
+
+// Options are where the spans are exported to, tracing is disabled if both are empty
+type Options struct {
+	// OTLPEndpoint is the url of an OTLP/HTTP collector, e.g. http://otel-collector:4318
+	OTLPEndpoint string
+	// File is a local file the spans are written to as JSON, one span per line
+	File string
+}
+
+// Setup installs the global tracer provider exporting to opts, the returned shutdown flushes the spans
+// and has to be called before exit
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if len(opts.OTLPEndpoint) == 0 && len(opts.File) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", ServiceName))
+	providerOpts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	var closers []func() error
+	if len(opts.OTLPEndpoint) != 0 {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("fail to create otlp exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+	if len(opts.File) != 0 {
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("fail to create file exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+		closers = append(closers, f.Close)
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, closer := range closers {
+			err = errors.Join(err, closer())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span of cluster-register
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ServiceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, and marks it failed if err isn't nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WrapConfig returns a copy of config whose requests are traced as child spans of the span in their context.
+// The config is wrapped regardless of Setup, whose tracer provider takes over the spans of the clients created
+// before it, and without Setup the spans are dropped.
+func WrapConfig(config *rest.Config) *rest.Config {
+	if config == nil {
+		return config
+	}
+	config = rest.CopyConfig(config)
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+	})
+	return config
+}
+
+// LogValues appends the trace id of ctx to the key values of a log, so that the logs are correlated with the spans
+func LogValues(ctx context.Context, keysAndValues ...interface{}) []interface{} {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return append(keysAndValues, "traceID", sc.TraceID().String())
+	}
+	return keysAndValues
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestWrapConfigBeforeSetup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+	// the client is created before the tracer provider is installed
+	httpClient, err := rest.HTTPClientFor(WrapConfig(&rest.Config{Host: server.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), Options{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpClient.Get(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(spans), `"Name":"GET /api"`) {
+		t.Errorf("expect the request to be traced, got %s", spans)
+	}
+}